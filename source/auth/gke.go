@@ -62,7 +62,7 @@ func (auth *gkeAuth) EnsureAccess() error {
 		ClusterCA:       cluster.GetMasterAuth().GetClusterCaCertificate(),
 	}
 	destination := fmt.Sprintf("%s/.kube/config", home())
-	err = utils.PopulateTemplateWrite("gke-kubeconfig.yaml", destination, values)
+	err = utils.PopulateBundledTemplateWrite("gke-kubeconfig.yaml", destination, values)
 	if err != nil {
 		return fmt.Errorf("Cannot write kubeconfig: %s", err)
 	}
@@ -0,0 +1,290 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"go.borchero.com/cuckoo/ci"
+	"go.borchero.com/cuckoo/providers"
+	"go.borchero.com/cuckoo/providers/storage"
+	"go.borchero.com/typewriter"
+)
+
+const chartDescription = `
+The chart command bundles subcommands to package and distribute local Helm charts: charts may be
+packaged into archives, pushed to OCI registries or published to Helm repositories stored in
+buckets. Local charts are treated in the same way as by the deploy command: there is no need for a
+Chart.yaml file to exist, it is generated from the given name and version. Dependencies should be
+put in a 'dependencies.yaml' file.
+`
+
+const chartPushDescription = `
+The push command packages a local Helm chart and pushes it to an OCI registry. The chart is pushed
+to <remote>/<name>:<version> where the remote must be given as oci://<host>/<path>.
+
+Authentication against the registry uses the Docker credentials, i.e. run 'cuckoo auth' prior to
+calling this command to write them.
+
+Version and tag may be templated in the same way as in the build command. Consult its
+documentation to read about these template values. The tag defines the appVersion of the chart.
+`
+
+const chartPackageDescription = `
+The package command packages a local Helm chart into a .tgz archive which is written to the given
+destination directory.
+
+Version and tag may be templated in the same way as in the build command. Consult its
+documentation to read about these template values. The tag defines the appVersion of the chart.
+`
+
+const chartPublishDescription = `
+The publish command packages a local Helm chart and publishes it to a Helm repository which is
+stored in an AWS S3 or Google Cloud Storage bucket. The repository's index.yaml is downloaded from
+the bucket, updated with the new chart and uploaded along with the packaged chart. Publishing a
+chart version that already exists in the repository fails. The prefix denotes a directory in the
+bucket, i.e. the prefix 'charts' stores the repository in 'charts/'.
+
+Updating the index is not guarded against concurrent updates: if multiple charts are published to
+the same repository at the same time, the index may only contain some of them. Make sure to
+publish charts to a repository sequentially, e.g. by serializing the corresponding CI jobs.
+
+Version and tag may be templated in the same way as in the build command. Consult its
+documentation to read about these template values. The tag defines the appVersion of the chart.
+`
+
+var chartArgs struct {
+	chart       string
+	name        string
+	version     string
+	image       string
+	tag         string
+	remote      string
+	destination string
+	provider    string
+	endpoint    storageEndpoint
+	bucket      string
+	prefix      string
+	url         string
+}
+
+func init() {
+	chartCommand := &cobra.Command{
+		Use:   "chart",
+		Short: "Package and distribute local Helm charts.",
+		Long:  chartDescription,
+	}
+
+	chartCommand.PersistentFlags().StringVar(
+		&chartArgs.chart, "chart", "./deploy/helm",
+		"The local chart to package.",
+	)
+	chartCommand.PersistentFlags().StringVar(
+		&chartArgs.name, "name", env.Project.Slug,
+		"The name of the chart.",
+	)
+	chartCommand.PersistentFlags().StringVar(
+		&chartArgs.version, "version", "%t",
+		"The version of the chart.",
+	)
+	chartCommand.PersistentFlags().StringVar(
+		&chartArgs.image, "image", "",
+		"The path of the image which is available when templating the default values.",
+	)
+	chartCommand.PersistentFlags().StringVarP(
+		&chartArgs.tag, "tag", "t", "",
+		"The tag of the image. Defines the appVersion of the chart.",
+	)
+
+	pushCommand := &cobra.Command{
+		Use:   "push",
+		Short: "Package a local Helm chart and push it to an OCI registry.",
+		Long:  chartPushDescription,
+		Args:  cobra.ExactArgs(0),
+		Run:   runChartPush,
+	}
+
+	pushCommand.Flags().StringVar(
+		&chartArgs.remote, "remote", "",
+		"The OCI registry to push the chart to (oci://<host>/<path>).",
+	)
+
+	packageCommand := &cobra.Command{
+		Use:   "package",
+		Short: "Package a local Helm chart into a .tgz archive.",
+		Long:  chartPackageDescription,
+		Args:  cobra.ExactArgs(0),
+		Run:   runChartPackage,
+	}
+
+	packageCommand.Flags().StringVarP(
+		&chartArgs.destination, "destination", "d", ".",
+		"The directory to write the packaged chart to.",
+	)
+
+	publishCommand := &cobra.Command{
+		Use:   "publish",
+		Short: "Package a local Helm chart and publish it to a Helm repository in a bucket.",
+		Long:  chartPublishDescription,
+		Args:  cobra.ExactArgs(0),
+		Run:   runChartPublish,
+	}
+
+	publishCommand.Flags().StringVar(
+		&chartArgs.provider, "provider", "s3",
+		"The provider to use to access the bucket (s3/gcs/azure/file).",
+	)
+	addStorageEndpointFlags(publishCommand, &chartArgs.endpoint)
+	publishCommand.Flags().StringVarP(
+		&chartArgs.bucket, "bucket", "b", "",
+		"The bucket which stores the Helm repository.",
+	)
+	publishCommand.Flags().StringVar(
+		&chartArgs.prefix, "prefix", "",
+		"The directory of the Helm repository within the bucket.",
+	)
+	publishCommand.Flags().StringVar(
+		&chartArgs.url, "url", "",
+		"The URL at which the repository is served. Charts are referenced relatively if not set.",
+	)
+
+	chartCommand.AddCommand(pushCommand)
+	chartCommand.AddCommand(packageCommand)
+	chartCommand.AddCommand(publishCommand)
+	rootCmd.AddCommand(chartCommand)
+}
+
+func runChartPush(cmd *cobra.Command, args []string) {
+	logger := typewriter.NewCLILogger()
+
+	// 1) Verify parameters
+	if chartArgs.remote == "" {
+		typewriter.Fail(logger, "Remote must be given", nil)
+	}
+
+	// 2) Get chart
+	release, values := chartRelease(logger)
+
+	// 3) Push
+	ref, err := release.Push(values, chartArgs.remote)
+	if err != nil {
+		typewriter.Fail(logger, "Failed to push chart", err)
+	}
+
+	logger.Infof("Pushed %s", ref)
+	logger.Success("Done 🎉")
+}
+
+func runChartPackage(cmd *cobra.Command, args []string) {
+	logger := typewriter.NewCLILogger()
+
+	// 1) Get chart
+	release, values := chartRelease(logger)
+
+	// 2) Package
+	path, err := release.Package(values, chartArgs.destination)
+	if err != nil {
+		typewriter.Fail(logger, "Failed to package chart", err)
+	}
+
+	logger.Infof("Packaged %s", path)
+	logger.Success("Done 🎉")
+}
+
+func runChartPublish(cmd *cobra.Command, args []string) {
+	logger := typewriter.NewCLILogger()
+
+	// 1) Verify parameters
+	if chartArgs.bucket == "" {
+		typewriter.Fail(logger, "Bucket must be given", nil)
+	}
+	chartArgs.prefix = storage.NormalizePrefix(chartArgs.prefix)
+
+	// 2) Get storage provider
+	provider, err := newStorageProvider(
+		chartArgs.provider, chartArgs.bucket, chartArgs.endpoint, logger,
+	)
+	if err != nil {
+		typewriter.Fail(logger, "Failed to get storage provider", err)
+	}
+
+	// 3) Package chart
+	release, values := chartRelease(logger)
+
+	dir, err := ioutil.TempDir("", "cuckoo-repository-*")
+	if err != nil {
+		typewriter.Fail(logger, "Failed to create temporary directory", err)
+	}
+	defer os.RemoveAll(dir)
+
+	chartPath, err := release.Package(values, dir)
+	if err != nil {
+		typewriter.Fail(logger, "Failed to package chart", err)
+	}
+
+	// 4) Update index
+	// 4.1) Download existing index
+	indexPath := filepath.Join(dir, "index.yaml")
+	indexBucketPath := chartArgs.prefix + "index.yaml"
+	err = provider.Download(indexBucketPath, indexPath)
+	if err == storage.ErrNotFound {
+		logger.Infof("Repository index does not exist yet, creating new index...")
+	} else if err != nil {
+		typewriter.Fail(logger, "Failed to download repository index", err)
+	}
+
+	// 4.2) Add chart
+	if err := providers.AddToHelmIndex(indexPath, chartPath, chartArgs.url); err != nil {
+		typewriter.Fail(logger, "Failed to update repository index", err)
+	}
+
+	// 5) Upload chart and index
+	transfer := []storage.TransferObject{
+		{LocalPath: chartPath, BucketPath: chartArgs.prefix + filepath.Base(chartPath)},
+		{LocalPath: indexPath, BucketPath: indexBucketPath},
+	}
+	if err := provider.Upload(transfer...); err != nil {
+		typewriter.Fail(logger, "Failed to upload chart", err)
+	}
+
+	logger.Success("Done 🎉")
+}
+
+// chartRelease returns the release describing the local chart along with the values used for
+// templating it. It fails if the chart cannot be initialized.
+func chartRelease(logger typewriter.CLILogger) (*providers.HelmRelease, providers.HelmValues) {
+	manager := ci.NewManager(env)
+
+	// 1) Expand templates
+	version, err := manager.TagFromTemplate(chartArgs.version)
+	if err != nil {
+		typewriter.Fail(logger, "Cannot use the specified version", err)
+	}
+
+	image, err := manager.ImageNameFromTemplate(chartArgs.image)
+	if err != nil {
+		typewriter.Fail(logger, "Cannot use the specified image", err)
+	}
+
+	tag, err := manager.TagFromTemplate(chartArgs.tag)
+	if err != nil {
+		typewriter.Fail(logger, "Cannot use the specified tag", err)
+	}
+
+	// 2) Get release
+	release, err := providers.NewHelmRelease(
+		"", chartArgs.chart, version, chartArgs.name, "", logger,
+	)
+	if err != nil {
+		typewriter.Fail(logger, "Failed to prepare chart", err)
+	}
+	if !release.IsLocalChart() {
+		typewriter.Fail(
+			logger, "Only local charts (including a templates directory) are supported", nil,
+		)
+	}
+
+	values := providers.HelmValues{Image: image, Tag: tag, Commit: helmCommit()}
+	return release, values
+}
@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+// applyConfig reads the section with the given name from the config file and sets all flags of the
+// command which have not been set explicitly. Keys of the config file are named like flags.
+func applyConfig(cmd *cobra.Command, section string) error {
+	// 1) Read config file if it exists
+	contents, err := ioutil.ReadFile(configFile)
+	if os.IsNotExist(err) && !cmd.Flags().Changed("config") {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Cannot read config file: %s", err)
+	}
+
+	var config map[string]map[string]interface{}
+	if err := yaml.Unmarshal(contents, &config); err != nil {
+		return fmt.Errorf("Cannot parse config file: %s", err)
+	}
+
+	// 2) Set flags from config
+	for key, value := range config[section] {
+		flag := cmd.Flags().Lookup(key)
+		if flag == nil {
+			return fmt.Errorf("Unknown key '%s' in section '%s' of config file", key, section)
+		}
+		if flag.Changed {
+			continue
+		}
+
+		// 2.1) Lists are passed to the flag value by value
+		values := []interface{}{value}
+		if list, ok := value.([]interface{}); ok {
+			values = list
+		}
+
+		for _, item := range values {
+			if err := cmd.Flags().Set(key, fmt.Sprintf("%v", item)); err != nil {
+				return fmt.Errorf("Invalid value for key '%s' in config file: %s", key, err)
+			}
+		}
+	}
+
+	return nil
+}
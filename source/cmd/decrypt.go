@@ -3,6 +3,7 @@ package cmd
 import (
 	"fmt"
 	"io/ioutil"
+	"os"
 	"regexp"
 
 	"github.com/spf13/cobra"
@@ -15,11 +16,35 @@ const decryptDescription = `
 The decrypt command recursively scans the current directory and all of its subdirectories to
 decrypt all files matching a particular pattern using Mozilla's Sops. This way, secrets can be
 stored within the repository and be made available easily for the CI.
+
+Decrypted files are only readable by the current user. The directories '.git' and 'node_modules'
+as well as all directories given by --skip are not scanned. To prevent committing plaintext secrets
+accidentally, every decrypted file must be ignored by git (e.g. via .gitignore), otherwise
+decryption fails before any file is written. The check is skipped if the current directory is not
+within a git repository or git is not installed. Use --require-ignored=false to disable it.
+
+The format of each file is detected from its name ('yml' and 'yaml', 'json', 'ini' and dotenv
+files such as 'app.enc.env' or '.env.production'), all other files are decrypted as binary files.
+Use --format to set the format of all files explicitly. Age identities can be passed via the
+SOPS_AGE_KEY environment variable (e.g. a masked CI variable) or the file given by
+SOPS_AGE_KEY_FILE.
+
+Using --check, files are decrypted in memory only to verify that they can be decrypted with the
+available keys. Using --clean, all decrypted files (i.e. the outputs of the matching encrypted
+files) are removed.
 `
 
+// defaultSkipDirs are the directories which are not scanned for secrets by default.
+var defaultSkipDirs = []string{".git", "node_modules"}
+
 var decryptArgs struct {
-	inputPattern string
-	output       string
+	inputPattern   string
+	output         string
+	skip           []string
+	requireIgnored bool
+	check          bool
+	clean          bool
+	format         string
 }
 
 func init() {
@@ -39,6 +64,26 @@ func init() {
 		&decryptArgs.output, "output", "o", "%s.%s",
 		"The format string to use for writing decrypted files. Uses the capture groups from -d.",
 	)
+	decryptCommand.Flags().StringArrayVar(
+		&decryptArgs.skip, "skip", []string{},
+		"The names of directories which are not scanned in addition to '.git' and 'node_modules'.",
+	)
+	decryptCommand.Flags().BoolVar(
+		&decryptArgs.requireIgnored, "require-ignored", true,
+		"Whether to fail if any decrypted file would not be ignored by git.",
+	)
+	decryptCommand.Flags().BoolVar(
+		&decryptArgs.check, "check", false,
+		"Whether to only verify that all files can be decrypted without writing them.",
+	)
+	decryptCommand.Flags().BoolVar(
+		&decryptArgs.clean, "clean", false,
+		"Whether to remove all previously decrypted files instead of decrypting.",
+	)
+	decryptCommand.Flags().StringVar(
+		&decryptArgs.format, "format", "",
+		"The format of all files (yaml, json, ini, dotenv or binary). Detected if not given.",
+	)
 
 	rootCmd.AddCommand(decryptCommand)
 }
@@ -47,38 +92,90 @@ func runDecrypt(cmd *cobra.Command, args []string) {
 	logger := typewriter.NewCLILogger()
 
 	// 1) Get all files matching pattern
-	matches, err := utils.GetMatchingFiles(decryptArgs.inputPattern, ".")
+	inputRegex, err := regexp.Compile(decryptArgs.inputPattern)
+	if err != nil {
+		typewriter.Fail(logger, "Invalid pattern", err)
+	}
+
+	skip := append(append([]string{}, defaultSkipDirs...), decryptArgs.skip...)
+	matches, err := utils.GetMatchingFilesSkipping(decryptArgs.inputPattern, ".", skip)
 	if err != nil {
 		typewriter.Fail(logger, "Could not find any files", err)
 	}
 
-	// 2) Decrypt all files
+	outputs := make(map[string]string)
+	for _, file := range matches {
+		outputs[file] = formatMatch(inputRegex, file, decryptArgs.output)
+		if outputs[file] == file {
+			typewriter.Fail(logger, fmt.Sprintf("Output of '%s' is the file itself", file), nil)
+		}
+	}
+
+	// 2) Remove decrypted files if requested
+	if decryptArgs.clean {
+		for _, file := range matches {
+			err := os.Remove(outputs[file])
+			if err == nil {
+				logger.Infof("Removed '%s'", outputs[file])
+			} else if !os.IsNotExist(err) {
+				typewriter.Fail(logger, "Could not remove decrypted file", err)
+			}
+		}
+		logger.Success("Done 🎉")
+		return
+	}
+
+	// 3) Ensure that decrypted files are ignored by git
+	requireIgnored := decryptArgs.requireIgnored && !decryptArgs.check
+	if requireIgnored && len(matches) > 0 && !utils.IsGitWorkTree(".") {
+		logger.Infof("Not within a git repository, not checking whether files are ignored...")
+		requireIgnored = false
+	}
+	if requireIgnored {
+		for _, file := range matches {
+			ignored, err := utils.IsGitIgnored(outputs[file])
+			if err != nil {
+				typewriter.Fail(logger, "Could not check whether decrypted file is ignored", err)
+			}
+			if !ignored {
+				message := fmt.Sprintf("Decrypted file '%s' is not ignored by git", outputs[file])
+				typewriter.Fail(logger, message, nil)
+			}
+		}
+	}
+
+	// 4) Decrypt all files
 	sops := providers.NewSops()
+	if err := sops.SetFormat(decryptArgs.format); err != nil {
+		typewriter.Fail(logger, "Invalid format", err)
+	}
+
 	for _, file := range matches {
-		// 2.1) Decrypt file
+		// 4.1) Decrypt file
 		logger.Infof("Decrypting '%s'...", file)
 		contents, err := sops.Decrypt(file)
 		if err != nil {
 			typewriter.Fail(logger, "Could not decrypt file", err)
-			return
 		}
-
-		// 2.2) Write decrypted contents
-		inputRegex := regexp.MustCompile(decryptArgs.inputPattern)
-		matches := inputRegex.FindStringSubmatch(file)
-
-		stringArgs := make([]interface{}, len(matches)-1)
-		for i, m := range matches[1:] {
-			stringArgs[i] = m
+		if decryptArgs.check {
+			continue
 		}
 
-		newFile := fmt.Sprintf(decryptArgs.output, stringArgs...)
-		err = ioutil.WriteFile(newFile, contents, 0644)
-		if err != nil {
+		// 4.2) Write decrypted contents
+		if err := writePrivateFile(outputs[file], contents); err != nil {
 			typewriter.Fail(logger, "Could not write decrypted file", err)
-			return
 		}
 	}
 
 	logger.Success("Done 🎉")
 }
+
+// writePrivateFile writes the given contents to the file such that it is only accessible by the
+// current user. Permissions of an existing file are restricted as well.
+func writePrivateFile(file string, contents []byte) error {
+	// WriteFile does not change the permissions of existing files
+	if err := os.Chmod(file, 0600); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return ioutil.WriteFile(file, contents, 0600)
+}
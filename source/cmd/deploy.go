@@ -1,9 +1,15 @@
 package cmd
 
 import (
+	"fmt"
+	"strings"
+	"time"
+
 	"github.com/spf13/cobra"
 	"go.borchero.com/cuckoo/ci"
 	"go.borchero.com/cuckoo/providers"
+	"go.borchero.com/cuckoo/providers/metrics"
+	"go.borchero.com/cuckoo/providers/traffic"
 	"go.borchero.com/typewriter"
 )
 
@@ -12,6 +18,9 @@ The deploy command deploys a Helm chart to a Kubernetes cluster. A Helm chart ma
 multiple ways:
 
 * Remote Charts: In this case, the --repo argument and the --chart argument must be given.
+* Registry Charts: In this case, only the --chart argument must be given as a reference to a chart
+	in an OCI registry (oci://<host>/<path>/<chart>). The --version argument defines the tag to
+	pull. Authentication uses the Docker credentials written by 'cuckoo auth'.
 * Local Charts: In this case, only the --chart argument must be given. Although the 'template'
 	folder must exist, there is no need for a Chart.yaml file to exist. Dependencies should be put
 	in a 'dependencies.yaml' file in this case.
@@ -22,10 +31,100 @@ multiple ways:
 	single file as Helm chart serves as an alternative for 'kubectl apply' and provides additional
 	features such as rollbacks.
 
-For (actual) local Helm charts, tag and image may be set, otherwise they are ignored. They
-automatically override the values 'image.name' and 'image.tag' in the values.yaml file. Tags and
-images may be templated in the same way as in the build command. Consult its documentation to read
-about these template values.
+Instead of Helm charts, plain Kubernetes manifests may be deployed natively via --manifests (a
+directory containing YAML or JSON files) or --kustomize (a directory containing a Kustomize
+overlay which is rendered without requiring the kustomize binary). Manifests are applied via
+server-side apply and labeled with 'cuckoo.borchero.com/release=<name>'. Resources which were part
+of the previous deployment but are not part of the manifests anymore are pruned if they carry this
+label. Revisions are stored in secrets of the release's namespace such that 'cuckoo rollback' can
+restore previous deployments. Chart-specific flags (image, tag, values, ...) are ignored in this
+mode.
+
+Multiple Helm releases may be deployed at once by passing a releases file via --releases. The file
+lists the releases along with their charts and values as well as the releases they depend on:
+
+	releases:
+	- name: database
+	  chart: ./deploy/database
+	  namespace: data
+	  values: [./deploy/database.yaml]
+	- name: backend
+	  chart: ./deploy/backend
+	  image: "%r/backend"
+	  set: [replicas=2]
+	  needs: [database]
+
+Supported keys are name, namespace, repo, chart, version, image, tag, values, secretValues, secrets,
+set, setString, setFile, setJson and needs. Namespace, version, image and tag default to the values
+given on the command line, all other flags (Helm behavior, --set-env-prefix, --dry-run) apply to all
+releases. Each release is deployed as soon as all of the releases it needs have been deployed
+successfully (without waiting for any other releases), i.e. releases which do not depend on each
+other are deployed in parallel. Releases whose dependencies failed are skipped. A summary of all
+releases is printed at the end. Releases are always upgraded in place without verification, i.e.
+--strategy (other than rolling), --test, --probe and --rollback-on-failure cannot be used along
+with --releases.
+
+For (actual) local Helm charts, tag and image automatically override the values 'image.name' and
+'image.tag' in the values.yaml file. Tags and images may be templated in the same way as in the
+build command. Consult its documentation to read about these template values.
+
+Values may further be set explicitly via --set, --set-string, --set-file and --set-json as well as
+from environment variables with the prefix given by --set-env-prefix: using the prefix HELM_VALUE_,
+the environment variable HELM_VALUE_foo_bar=1 sets the value 'foo.bar' to 1. Explicitly set values
+take precedence over values files and the injected image values. Among them, the precedence is
+(lowest to highest): --set-json, environment variables, --set, --set-string, --set-file.
+
+Secrets do not need to be decrypted prior to deployment (e.g. via 'cuckoo decrypt'). Instead,
+--secret-values passes Sops-encrypted values files which are decrypted in memory. Their values take
+precedence over regular values files. Further, --secret <name>=<file> generates a Kubernetes secret
+with the given name from a Sops-encrypted file and adds it to the release. Dotenv (.env), YAML and
+JSON files yield one key per (top-level) entry while all other files yield a single key named after
+the file (without '.enc'). Plaintext secrets are never written to disk.
+
+The default values.yaml of local charts as well as all values files passed via -f are templated
+with Go's template engine prior to deployment. Templating never modifies the files themselves. The
+following data is available:
+
+* {{ .Name }} and {{ .Namespace }}: The name and the namespace of the Helm release.
+* {{ .Image }} and {{ .Tag }}: The (expanded) image and tag given via --image and --tag.
+* {{ .Commit.Hash }}, {{ .Commit.ShortHash }} and {{ .Commit.Tag }}: Information about the current
+	commit, given by CI_COMMIT_SHA and CI_COMMIT_TAG.
+* {{ .Branch.Name }} and {{ .Branch.Slug }}: The name of the current branch and its slug, given by
+	CI_COMMIT_REF_NAME and CI_COMMIT_REF_SLUG.
+* {{ .Env.<NAME> }}: The value of any environment variable.
+
+After a successful deployment, the release may be verified: --test runs the chart's Helm test hooks
+and --probe checks HTTP endpoints, e.g. --probe "url=https://example.com/health,status=200,
+body=ok". The status defaults to 200 and the body is matched as regular expression (it must be
+given last). Commas only separate values if followed by a key, i.e. URLs may contain commas.
+Probes are retried until they succeed or --probe-attempts (at least 1) is exhausted. If
+verification fails, the release is automatically rolled back to its previous revision (or
+uninstalled if it was installed for the first time) unless --rollback-on-failure=false is given.
+Verification is skipped for dry-runs.
+
+Instead of upgrading the release in place (--strategy rolling), new versions may be rolled out
+progressively. Using --strategy canary, the chart is deployed as separate release '<name>-canary'
+in the same namespace with the same values. Traffic is then shifted to the canary in the steps
+given by --canary-steps, waiting for --step-interval after each step. Using --strategy bluegreen,
+all traffic is switched to the new version at once. Traffic is shifted in one of two ways:
+
+* NGINX (--traffic nginx): The canary annotations of the NGINX ingress controller are set on the
+	canary's ingress (--canary-ingress, defaults to '<name>-canary'). The canary is installed with
+	these annotations and a weight of 0 set in its values at --canary-ingress-annotations such that
+	its ingress never receives traffic before the first step.
+* Annotations (--traffic annotation): The canary's weight (0-100) is written to the annotation
+	--traffic-annotation of the service or ingress given by --traffic-object (e.g. Service/app).
+
+After each step, the query given by --metric-query is evaluated against the Prometheus-compatible
+API at --prometheus-url. If the result exceeds --metric-max, the rollout is aborted: all traffic is
+routed back to the stable release and the canary is removed. If all steps succeed, the canary is
+promoted by upgrading the stable release and removing the canary. If --test is given, the canary's
+Helm tests are run before any traffic is shifted.
+
+The behavior of Helm (timeouts, atomicity, waiting, history limits, ...) can be configured via
+flags. Alternatively, all flags may be set in the 'deploy' section of the config file (see
+--config), using the flag names as keys. Flags given on the command line take precedence over the
+config file.
 
 Make sure to be authenticated for Kubernetes or run 'cuckoo auth' prior to calling this command to
 write the kubeconfig file.
@@ -41,6 +140,49 @@ var deployArgs struct {
 	image     string
 	tag       string
 	dryRun    bool
+	kustomize string
+	manifests string
+	releases  string
+	helm      struct {
+		timeout         time.Duration
+		atomic          bool
+		wait            bool
+		waitForJobs     bool
+		maxHistory      int
+		force           bool
+		resetValues     bool
+		reuseValues     bool
+		createNamespace bool
+	}
+	set struct {
+		values       []string
+		stringValues []string
+		fileValues   []string
+		jsonValues   []string
+		envPrefix    string
+		secretFiles  []string
+		secrets      []string
+	}
+	verify struct {
+		test     bool
+		probes   []string
+		attempts int
+		interval time.Duration
+		rollback bool
+	}
+	strategy struct {
+		name       string
+		steps      []int
+		interval   time.Duration
+		traffic    string
+		ingress    string
+		ingressKey string
+		object     string
+		annotation string
+		prometheus string
+		query      string
+		max        float64
+	}
 }
 
 func init() {
@@ -62,7 +204,7 @@ func init() {
 	)
 	deployCommand.Flags().StringVar(
 		&deployArgs.version, "version", "0.0.0",
-		"The version of the chart to deploy. Only relevant for remote charts.",
+		"The version of the chart to deploy. Only relevant for remote and registry charts.",
 	)
 	deployCommand.Flags().StringVar(
 		&deployArgs.name, "name", env.Project.Slug,
@@ -72,23 +214,166 @@ func init() {
 		&deployArgs.values, "values", "f", []string{},
 		"A path to one or multiple value files to set values from.",
 	)
+	deployCommand.Flags().StringArrayVar(
+		&deployArgs.set.secretFiles, "secret-values", []string{},
+		"A path to a Sops-encrypted value file which is decrypted in memory.",
+	)
+	deployCommand.Flags().StringArrayVar(
+		&deployArgs.set.secrets, "secret", []string{},
+		"A Kubernetes secret to generate from a Sops-encrypted file (<name>=<file>).",
+	)
+	deployCommand.Flags().StringArrayVar(
+		&deployArgs.set.values, "set", []string{},
+		"Values to set (key1=val1,key2=val2). Takes precedence over value files.",
+	)
+	deployCommand.Flags().StringArrayVar(
+		&deployArgs.set.stringValues, "set-string", []string{},
+		"String values to set (key1=val1,key2=val2). Takes precedence over value files.",
+	)
+	deployCommand.Flags().StringArrayVar(
+		&deployArgs.set.fileValues, "set-file", []string{},
+		"Values to set from files (key1=path1,key2=path2). Takes precedence over value files.",
+	)
+	deployCommand.Flags().StringArrayVar(
+		&deployArgs.set.jsonValues, "set-json", []string{},
+		"JSON values to set (key=<json>). Takes precedence over value files.",
+	)
+	deployCommand.Flags().StringVar(
+		&deployArgs.set.envPrefix, "set-env-prefix", "",
+		"A prefix of environment variables to set values from (e.g. HELM_VALUE_).",
+	)
 	deployCommand.Flags().StringVarP(
 		&deployArgs.namespace, "namespace", "n", "default",
 		"The namespace for deployed resources.",
 	)
 	deployCommand.Flags().StringVar(
 		&deployArgs.image, "image", "",
-		"The path for the image to deploy.",
+		"The path for the image to deploy. Only relevant for local charts and values templates.",
 	)
 	deployCommand.Flags().StringVarP(
 		&deployArgs.tag, "tag", "t", "",
 		"The tag of the image to use for deployment. Defines appVersion of local charts.",
 	)
+	deployCommand.Flags().StringVar(
+		&deployArgs.kustomize, "kustomize", "",
+		"A directory with a Kustomize overlay to deploy instead of a Helm chart.",
+	)
+	deployCommand.Flags().StringVar(
+		&deployArgs.manifests, "manifests", "",
+		"A directory with plain Kubernetes manifests to deploy instead of a Helm chart.",
+	)
+	deployCommand.Flags().StringVar(
+		&deployArgs.releases, "releases", "",
+		"A file describing multiple Helm releases to deploy instead of a single chart.",
+	)
 	deployCommand.Flags().BoolVar(
 		&deployArgs.dryRun, "dry-run", false,
 		"Whether to perform a dry-run (useful for testing the chart).",
 	)
 
+	deployCommand.Flags().DurationVar(
+		&deployArgs.helm.timeout, "timeout", 15*time.Minute,
+		"The time to wait for any individual Kubernetes operation.",
+	)
+	deployCommand.Flags().BoolVar(
+		&deployArgs.helm.atomic, "atomic", true,
+		"Whether to roll back changes if the deployment fails. Implies --wait.",
+	)
+	deployCommand.Flags().BoolVar(
+		&deployArgs.helm.wait, "wait", true,
+		"Whether to wait until all resources are ready before marking the release as successful.",
+	)
+	deployCommand.Flags().BoolVar(
+		&deployArgs.helm.waitForJobs, "wait-for-jobs", false,
+		"Whether to wait until all jobs have completed before marking the release as successful.",
+	)
+	deployCommand.Flags().IntVar(
+		&deployArgs.helm.maxHistory, "max-history", 10,
+		"The maximum number of revisions to keep for the release (0 for no limit).",
+	)
+	deployCommand.Flags().BoolVar(
+		&deployArgs.helm.force, "force", false,
+		"Whether to force resource updates through a replacement strategy.",
+	)
+	deployCommand.Flags().BoolVar(
+		&deployArgs.helm.resetValues, "reset-values", false,
+		"Whether to reset the values to the ones built into the chart when upgrading.",
+	)
+	deployCommand.Flags().BoolVar(
+		&deployArgs.helm.reuseValues, "reuse-values", false,
+		"Whether to reuse the values of the last release when upgrading and merge overrides.",
+	)
+	deployCommand.Flags().BoolVar(
+		&deployArgs.helm.createNamespace, "create-namespace", false,
+		"Whether to create the namespace if it does not exist when installing.",
+	)
+
+	deployCommand.Flags().BoolVar(
+		&deployArgs.verify.test, "test", false,
+		"Whether to run the release's Helm test hooks after deploying.",
+	)
+	deployCommand.Flags().StringArrayVar(
+		&deployArgs.verify.probes, "probe", []string{},
+		"An HTTP endpoint to verify after deploying (url=<url>,status=<code>,body=<regex>).",
+	)
+	deployCommand.Flags().IntVar(
+		&deployArgs.verify.attempts, "probe-attempts", 10,
+		"The maximum number of attempts for each HTTP probe.",
+	)
+	deployCommand.Flags().DurationVar(
+		&deployArgs.verify.interval, "probe-interval", 10*time.Second,
+		"The time to wait between attempts of HTTP probes.",
+	)
+	deployCommand.Flags().BoolVar(
+		&deployArgs.verify.rollback, "rollback-on-failure", true,
+		"Whether to roll back to the previous revision (or uninstall) if verification fails.",
+	)
+
+	deployCommand.Flags().StringVar(
+		&deployArgs.strategy.name, "strategy", "rolling",
+		"The deployment strategy (rolling/canary/bluegreen).",
+	)
+	deployCommand.Flags().IntSliceVar(
+		&deployArgs.strategy.steps, "canary-steps", []int{10, 25, 50, 100},
+		"The percentages of traffic routed to the canary in subsequent steps.",
+	)
+	deployCommand.Flags().DurationVar(
+		&deployArgs.strategy.interval, "step-interval", time.Minute,
+		"The time to wait after each step of a canary or blue/green rollout.",
+	)
+	deployCommand.Flags().StringVar(
+		&deployArgs.strategy.traffic, "traffic", "nginx",
+		"The method to shift traffic to the canary (nginx/annotation).",
+	)
+	deployCommand.Flags().StringVar(
+		&deployArgs.strategy.ingress, "canary-ingress", "",
+		"The canary's ingress when using NGINX for shifting traffic. Defaults to <name>-canary.",
+	)
+	deployCommand.Flags().StringVar(
+		&deployArgs.strategy.ingressKey, "canary-ingress-annotations", "ingress.annotations",
+		"The key of the chart's values which holds the annotations of the canary's ingress.",
+	)
+	deployCommand.Flags().StringVar(
+		&deployArgs.strategy.object, "traffic-object", "",
+		"The object to annotate with the canary's weight (Service/<name> or Ingress/<name>).",
+	)
+	deployCommand.Flags().StringVar(
+		&deployArgs.strategy.annotation, "traffic-annotation", "",
+		"The annotation to write the canary's weight to.",
+	)
+	deployCommand.Flags().StringVar(
+		&deployArgs.strategy.prometheus, "prometheus-url", "",
+		"The URL of a Prometheus-compatible API to query metrics from during rollouts.",
+	)
+	deployCommand.Flags().StringVar(
+		&deployArgs.strategy.query, "metric-query", "",
+		"The query to check after each step of a rollout. Must yield a single value.",
+	)
+	deployCommand.Flags().Float64Var(
+		&deployArgs.strategy.max, "metric-max", 0,
+		"The maximum value of the metric query, the rollout is aborted if it is exceeded.",
+	)
+
 	rootCmd.AddCommand(deployCommand)
 }
 
@@ -96,7 +381,43 @@ func runDeploy(cmd *cobra.Command, args []string) {
 	logger := typewriter.NewCLILogger()
 	manager := ci.NewManager(env)
 
-	// 1) Configure Helm release
+	// 1) Read configuration
+	if err := applyConfig(cmd, "deploy"); err != nil {
+		typewriter.Fail(logger, "Failed to read configuration", err)
+	}
+	if deployArgs.helm.resetValues && deployArgs.helm.reuseValues {
+		typewriter.Fail(logger, "Only one of --reset-values and --reuse-values may be set", nil)
+	}
+	if deployArgs.kustomize != "" && deployArgs.manifests != "" {
+		typewriter.Fail(logger, "Only one of --kustomize and --manifests may be set", nil)
+	}
+	if deployArgs.kustomize != "" || deployArgs.manifests != "" {
+		deployManifests(logger)
+		return
+	}
+
+	// 2) Configure Helm upgrades
+	options := providers.HelmUpgradeOptions{
+		Timeout:         deployArgs.helm.timeout,
+		Atomic:          deployArgs.helm.atomic,
+		Wait:            deployArgs.helm.wait,
+		WaitForJobs:     deployArgs.helm.waitForJobs,
+		MaxHistory:      deployArgs.helm.maxHistory,
+		Force:           deployArgs.helm.force,
+		ResetValues:     deployArgs.helm.resetValues,
+		ReuseValues:     deployArgs.helm.reuseValues,
+		CreateNamespace: deployArgs.helm.createNamespace,
+		DryRun:          deployArgs.dryRun,
+	}
+	if deployArgs.releases != "" {
+		if err := checkReleasesFlags(cmd); err != nil {
+			typewriter.Fail(logger, "Cannot deploy releases file", err)
+		}
+		deployReleases(logger, options)
+		return
+	}
+
+	// 3) Configure Helm release
 	release, err := providers.NewHelmRelease(
 		deployArgs.repo, deployArgs.chart, deployArgs.version,
 		deployArgs.name, deployArgs.namespace, logger,
@@ -105,26 +426,338 @@ func runDeploy(cmd *cobra.Command, args []string) {
 		typewriter.Fail(logger, "Failed to prepare deployment", err)
 	}
 
-	// 2) Get image and tag for local charts
-	image := ""
-	tag := ""
-	if release.IsLocalChart() {
-		image, err = manager.ImageNameFromTemplate(deployArgs.image)
+	// 4) Get values
+	image, err := manager.ImageNameFromTemplate(deployArgs.image)
+	if err != nil {
+		typewriter.Fail(logger, "Cannot use the specified image", err)
+	}
+
+	tag, err := manager.TagFromTemplate(deployArgs.tag)
+	if err != nil {
+		typewriter.Fail(logger, "Cannot use the specified tag", err)
+	}
+
+	secrets, err := parseSecrets(deployArgs.set.secrets)
+	if err != nil {
+		typewriter.Fail(logger, "Cannot use the specified secrets", err)
+	}
+
+	values := providers.HelmValues{
+		Files:        deployArgs.values,
+		SecretFiles:  deployArgs.set.secretFiles,
+		Secrets:      secrets,
+		Values:       deployArgs.set.values,
+		StringValues: deployArgs.set.stringValues,
+		FileValues:   deployArgs.set.fileValues,
+		JSONValues:   deployArgs.set.jsonValues,
+		EnvPrefix:    deployArgs.set.envPrefix,
+		Image:        image,
+		Tag:          tag,
+		Commit:       helmCommit(),
+	}
+
+	if deployArgs.verify.attempts < 1 {
+		typewriter.Fail(logger, "Probes must be attempted at least once", nil)
+	}
+	probes := make([]providers.HTTPProbe, len(deployArgs.verify.probes))
+	for i, spec := range deployArgs.verify.probes {
+		probe, err := providers.ParseHTTPProbe(spec)
 		if err != nil {
-			typewriter.Fail(logger, "Cannot use the specified image", err)
+			typewriter.Fail(logger, "Cannot use the specified probe", err)
 		}
+		probes[i] = probe
+	}
 
-		tag, err = manager.TagFromTemplate(deployArgs.tag)
-		if err != nil {
-			typewriter.Fail(logger, "Cannot use the specified tag", err)
+	// 5) Run upgrade
+	switch deployArgs.strategy.name {
+	case "rolling":
+		err = release.Upgrade(values, options)
+	case "canary", "bluegreen":
+		err = rolloutRelease(release, values, options, logger)
+	default:
+		typewriter.Fail(logger, "Unknown deployment strategy", nil)
+	}
+	if err != nil {
+		typewriter.Fail(logger, "Failed to deploy", err)
+	}
+
+	// 6) Verify release
+	if !deployArgs.dryRun {
+		if err := verifyRelease(release, probes, logger); err != nil {
+			if deployArgs.verify.rollback {
+				if revertErr := release.Revert(options); revertErr != nil {
+					err = fmt.Errorf("%s (failed to roll back: %s)", err, revertErr)
+				}
+			}
+			typewriter.Fail(logger, "Failed to verify deployment", err)
 		}
 	}
 
-	// 3) Run upgrade
-	err = release.Upgrade(deployArgs.values, image, tag, deployArgs.dryRun)
+	logger.Success("Done 🎉")
+}
+
+// verifyRelease runs the Helm tests (if enabled) and checks the given probes for the deployed
+// release.
+func verifyRelease(
+	release *providers.HelmRelease, probes []providers.HTTPProbe, logger typewriter.CLILogger,
+) error {
+	// 1) Run tests
+	if deployArgs.verify.test {
+		if err := release.Test(deployArgs.helm.timeout); err != nil {
+			return err
+		}
+	}
+
+	// 2) Check probes
+	return providers.VerifyHTTPProbes(
+		probes, deployArgs.verify.attempts, deployArgs.verify.interval, logger,
+	)
+}
+
+// deployManifests deploys the plain manifests or the Kustomize overlay given via the command line.
+func deployManifests(logger typewriter.CLILogger) {
+	// 1) Configure release
+	release, err := providers.NewManifestRelease(deployArgs.name, deployArgs.namespace, logger)
+	if err != nil {
+		typewriter.Fail(logger, "Failed to prepare deployment", err)
+	}
+
+	// 2) Apply manifests
+	source := providers.ManifestSource{Dir: deployArgs.manifests}
+	if deployArgs.kustomize != "" {
+		source = providers.ManifestSource{Dir: deployArgs.kustomize, Kustomize: true}
+	}
+
+	err = release.Apply(source, deployArgs.helm.maxHistory, deployArgs.dryRun)
 	if err != nil {
 		typewriter.Fail(logger, "Failed to deploy", err)
 	}
 
 	logger.Success("Done 🎉")
 }
+
+// rolloutRelease deploys the release progressively according to the strategy given via the
+// command line.
+func rolloutRelease(
+	release *providers.HelmRelease, values providers.HelmValues,
+	options providers.HelmUpgradeOptions, logger typewriter.CLILogger,
+) error {
+	// 1) Get canary
+	canaryName := fmt.Sprintf("%s-canary", deployArgs.name)
+	canary, err := providers.NewHelmRelease(
+		deployArgs.repo, deployArgs.chart, deployArgs.version,
+		canaryName, deployArgs.namespace, logger,
+	)
+	if err != nil {
+		return err
+	}
+
+	// 2) Get traffic provider
+	var router traffic.Provider
+	switch deployArgs.strategy.traffic {
+	case "nginx":
+		ingress := stringOrDefault(deployArgs.strategy.ingress, canaryName)
+		router, err = traffic.NewNginx(
+			deployArgs.namespace, ingress, deployArgs.strategy.ingressKey,
+		)
+	case "annotation":
+		parts := strings.SplitN(deployArgs.strategy.object, "/", 2)
+		if len(parts) != 2 || deployArgs.strategy.annotation == "" {
+			return fmt.Errorf("Annotation traffic requires an object and an annotation")
+		}
+		router, err = traffic.NewAnnotation(
+			deployArgs.namespace, parts[0], parts[1], deployArgs.strategy.annotation,
+		)
+	default:
+		return fmt.Errorf("Unknown traffic method '%s'", deployArgs.strategy.traffic)
+	}
+	if err != nil {
+		return err
+	}
+
+	// 3) Get analysis
+	var analysis *providers.CanaryAnalysis
+	if deployArgs.strategy.query != "" {
+		if deployArgs.strategy.prometheus == "" {
+			return fmt.Errorf("Metric queries require a Prometheus URL")
+		}
+		prometheus, err := metrics.NewPrometheus(deployArgs.strategy.prometheus)
+		if err != nil {
+			return err
+		}
+		analysis = &providers.CanaryAnalysis{
+			Metrics: prometheus,
+			Query:   deployArgs.strategy.query,
+			Max:     deployArgs.strategy.max,
+		}
+	}
+
+	// 4) Run rollout
+	steps := deployArgs.strategy.steps
+	if deployArgs.strategy.name == "bluegreen" {
+		steps = []int{100}
+	}
+
+	rollout := providers.CanaryRollout{
+		Stable:   release,
+		Canary:   canary,
+		Traffic:  router,
+		Steps:    steps,
+		Interval: deployArgs.strategy.interval,
+		Analysis: analysis,
+		Logger:   logger,
+	}
+	if deployArgs.verify.test {
+		rollout.Verify = func() error {
+			return canary.Test(deployArgs.helm.timeout)
+		}
+	}
+	return rollout.Run(values, options)
+}
+
+// deployReleases deploys all releases from the releases file given via the command line. Each
+// release is deployed as soon as all releases it needs have been deployed.
+func deployReleases(logger typewriter.CLILogger, options providers.HelmUpgradeOptions) {
+	manager := ci.NewManager(env)
+
+	// 1) Read releases
+	file, err := providers.ReadHelmReleasesFile(deployArgs.releases)
+	if err != nil {
+		typewriter.Fail(logger, "Failed to read releases", err)
+	}
+
+	// 2) Prepare all releases. This must happen sequentially as Helm reads the namespace of a
+	// release from the environment.
+	releases := make(map[string]*providers.HelmRelease)
+	values := make(map[string]providers.HelmValues)
+	for _, spec := range file.Releases {
+		release, releaseValues, err := prepareRelease(spec, manager, logger)
+		if err != nil {
+			typewriter.Fail(logger, fmt.Sprintf("Failed to prepare release '%s'", spec.Name), err)
+		}
+		releases[spec.Name] = release
+		values[spec.Name] = releaseValues
+	}
+
+	// 3) Deploy releases as soon as their dependencies are deployed
+	results := file.Deploy(func(spec providers.HelmReleaseSpec) error {
+		return releases[spec.Name].Upgrade(values[spec.Name], options)
+	})
+
+	// 4) Report results
+	failures := 0
+	for _, spec := range file.Releases {
+		if err := results[spec.Name]; err != nil {
+			failures++
+			logger.Errorf("[ ] %s: %s", spec.Name, err)
+		} else {
+			logger.Infof("[x] %s", spec.Name)
+		}
+	}
+
+	if failures > 0 {
+		message := fmt.Sprintf("Failed to deploy %d of %d releases", failures, len(file.Releases))
+		typewriter.Fail(logger, message, nil)
+	}
+
+	logger.Success("Done 🎉")
+}
+
+// checkReleasesFlags returns an error if any flag is set which cannot be applied when deploying a
+// releases file: releases are always upgraded in place and not verified.
+func checkReleasesFlags(cmd *cobra.Command) error {
+	if deployArgs.strategy.name != "rolling" {
+		return fmt.Errorf("--strategy %s is not supported", deployArgs.strategy.name)
+	}
+	if deployArgs.verify.test || len(deployArgs.verify.probes) > 0 {
+		return fmt.Errorf("Releases cannot be verified via --test or --probe")
+	}
+	if cmd.Flags().Changed("rollback-on-failure") {
+		return fmt.Errorf("--rollback-on-failure is not supported")
+	}
+	return nil
+}
+
+// prepareRelease initializes the Helm release described by the given specification along with
+// its values. Unset properties are taken from the command line.
+func prepareRelease(
+	spec providers.HelmReleaseSpec, manager *ci.Manager, logger typewriter.CLILogger,
+) (*providers.HelmRelease, providers.HelmValues, error) {
+	values := providers.HelmValues{}
+
+	// 1) Get release
+	if spec.Chart == "" {
+		return nil, values, fmt.Errorf("Chart must be given")
+	}
+
+	namespace := stringOrDefault(spec.Namespace, deployArgs.namespace)
+	version := stringOrDefault(spec.Version, deployArgs.version)
+	release, err := providers.NewHelmRelease(
+		spec.Repo, spec.Chart, version, spec.Name, namespace, logger,
+	)
+	if err != nil {
+		return nil, values, err
+	}
+
+	// 2) Get values
+	image, err := manager.ImageNameFromTemplate(stringOrDefault(spec.Image, deployArgs.image))
+	if err != nil {
+		return nil, values, fmt.Errorf("Cannot use the specified image: %s", err)
+	}
+
+	tag, err := manager.TagFromTemplate(stringOrDefault(spec.Tag, deployArgs.tag))
+	if err != nil {
+		return nil, values, fmt.Errorf("Cannot use the specified tag: %s", err)
+	}
+
+	secrets, err := parseSecrets(spec.Secrets)
+	if err != nil {
+		return nil, values, err
+	}
+
+	values = providers.HelmValues{
+		Files:        spec.Values,
+		SecretFiles:  spec.SecretValues,
+		Secrets:      secrets,
+		Values:       spec.Set,
+		StringValues: spec.SetString,
+		FileValues:   spec.SetFile,
+		JSONValues:   spec.SetJSON,
+		EnvPrefix:    deployArgs.set.envPrefix,
+		Image:        image,
+		Tag:          tag,
+		Commit:       helmCommit(),
+	}
+	return release, values, nil
+}
+
+// parseSecrets parses all secrets given as '<name>=<file>'.
+func parseSecrets(specs []string) ([]providers.HelmSecret, error) {
+	result := make([]providers.HelmSecret, len(specs))
+	for i, spec := range specs {
+		secret, err := providers.ParseHelmSecret(spec)
+		if err != nil {
+			return nil, err
+		}
+		result[i] = secret
+	}
+	return result, nil
+}
+
+func stringOrDefault(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+// helmCommit returns the information about the current commit which is made available when
+// templating values.
+func helmCommit() providers.HelmCommit {
+	return providers.HelmCommit{
+		Hash:       env.Commit.Hash,
+		Tag:        env.Commit.Tag,
+		Branch:     env.Commit.Branch,
+		BranchSlug: env.Commit.Slug,
+	}
+}
@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+
+	"github.com/spf13/cobra"
+	"go.borchero.com/cuckoo/providers"
+	"go.borchero.com/cuckoo/utils"
+	"go.borchero.com/typewriter"
+)
+
+const encryptDescription = `
+The encrypt command recursively scans the current directory and all of its subdirectories to
+encrypt all files matching a particular pattern using Mozilla's Sops. It is the counterpart of the
+decrypt command: by default, 'secrets.dec.yaml' is encrypted to 'secrets.enc.yaml'.
+
+Master keys and encryption settings are read from the Sops config file (.sops.yaml) in the same
+way as Sops does. The creation rules are matched against the paths of the encrypted files. The
+format of each file is detected from its name in the same way as for the decrypt command, use
+--format to set it explicitly.
+`
+
+var encryptArgs struct {
+	inputPattern string
+	output       string
+	sopsConfig   string
+	format       string
+}
+
+func init() {
+	encryptCommand := &cobra.Command{
+		Use:   "encrypt",
+		Short: "Encrypt all files in the current directory and its subdirectories using Sops.",
+		Long:  encryptDescription,
+		Args:  cobra.ExactArgs(0),
+		Run:   runEncrypt,
+	}
+
+	encryptCommand.Flags().StringVarP(
+		&encryptArgs.inputPattern, "encrypt", "e", "^(.*)\\.dec\\.(.*)$",
+		"The regex to apply for matching files to encrypt. May define capture groups.",
+	)
+	encryptCommand.Flags().StringVarP(
+		&encryptArgs.output, "output", "o", "%s.enc.%s",
+		"The format string to use for writing encrypted files. Uses the capture groups from -e.",
+	)
+	encryptCommand.Flags().StringVar(
+		&encryptArgs.sopsConfig, "sops-config", "",
+		"The Sops config file. Searched in the current directory and its parents if not given.",
+	)
+	encryptCommand.Flags().StringVar(
+		&encryptArgs.format, "format", "",
+		"The format of all files (yaml, json, ini, dotenv or binary). Detected if not given.",
+	)
+
+	rootCmd.AddCommand(encryptCommand)
+}
+
+func runEncrypt(cmd *cobra.Command, args []string) {
+	logger := typewriter.NewCLILogger()
+
+	// 1) Get all files matching pattern
+	inputRegex, err := regexp.Compile(encryptArgs.inputPattern)
+	if err != nil {
+		typewriter.Fail(logger, "Invalid pattern", err)
+	}
+
+	matches, err := utils.GetMatchingFilesSkipping(encryptArgs.inputPattern, ".", defaultSkipDirs)
+	if err != nil {
+		typewriter.Fail(logger, "Could not find any files", err)
+	}
+
+	// 2) Encrypt all files
+	sops := providers.NewSops()
+	if err := sops.SetFormat(encryptArgs.format); err != nil {
+		typewriter.Fail(logger, "Invalid format", err)
+	}
+
+	for _, file := range matches {
+		// 2.1) Encrypt file
+		newFile := formatMatch(inputRegex, file, encryptArgs.output)
+		logger.Infof("Encrypting '%s' to '%s'...", file, newFile)
+
+		contents, err := sops.Encrypt(file, newFile, encryptArgs.sopsConfig)
+		if err != nil {
+			typewriter.Fail(logger, "Could not encrypt file", err)
+		}
+
+		// 2.2) Write encrypted contents
+		if err := ioutil.WriteFile(newFile, contents, 0644); err != nil {
+			typewriter.Fail(logger, "Could not write encrypted file", err)
+		}
+	}
+
+	logger.Success("Done 🎉")
+}
+
+// formatMatch formats the given format string with the capture groups of the pattern's match in
+// the given file.
+func formatMatch(pattern *regexp.Regexp, file, format string) string {
+	matches := pattern.FindStringSubmatch(file)
+
+	stringArgs := make([]interface{}, len(matches)-1)
+	for i, m := range matches[1:] {
+		stringArgs[i] = m
+	}
+
+	return fmt.Sprintf(format, stringArgs...)
+}
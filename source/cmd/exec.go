@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+
+	"github.com/spf13/cobra"
+	"go.borchero.com/cuckoo/providers"
+	"go.borchero.com/typewriter"
+)
+
+const execDescription = `
+The exec command decrypts Sops-encrypted dotenv, YAML or JSON files in memory and runs the given
+command with their values as additional environment variables. This way, secrets can be passed to
+processes without ever writing plaintext to disk:
+
+	cuckoo exec --secrets app.enc.env -- ./run-migrations.sh
+
+Nested values of YAML and JSON files are flattened by joining their keys with underscores, e.g.
+'database: {user: admin}' yields DATABASE_USER=admin. All variable names are uppercased and
+prefixed with --prefix. Secrets override existing environment variables with the same name. The
+command replaces the cuckoo process, i.e. signals and the exit code are passed through directly.
+
+The format of each file is detected from its name (e.g. 'app.enc.env', '.env.production' or
+'config.enc.yml'), use --format to set it explicitly.
+`
+
+var execArgs struct {
+	secrets []string
+	prefix  string
+	format  string
+}
+
+func init() {
+	execCommand := &cobra.Command{
+		Use:   "exec -- <command> [args...]",
+		Short: "Run a command with decrypted secrets as environment variables.",
+		Long:  execDescription,
+		Args:  cobra.MinimumNArgs(1),
+		Run:   runExec,
+	}
+
+	execCommand.Flags().StringArrayVar(
+		&execArgs.secrets, "secrets", []string{},
+		"A Sops-encrypted dotenv, YAML or JSON file to read environment variables from.",
+	)
+	execCommand.Flags().StringVar(
+		&execArgs.prefix, "prefix", "",
+		"The prefix to prepend to the names of all environment variables.",
+	)
+	execCommand.Flags().StringVar(
+		&execArgs.format, "format", "",
+		"The format of all secrets files (yaml, json or dotenv). Detected if not given.",
+	)
+
+	rootCmd.AddCommand(execCommand)
+}
+
+func runExec(cmd *cobra.Command, args []string) {
+	logger := typewriter.NewCLILogger()
+
+	// 1) Decrypt secrets
+	environment := os.Environ()
+	sops := providers.NewSops()
+	if err := sops.SetFormat(execArgs.format); err != nil {
+		typewriter.Fail(logger, "Invalid format", err)
+	}
+
+	for _, file := range execArgs.secrets {
+		values, err := sops.DecryptEnvironment(file, execArgs.prefix)
+		if err != nil {
+			typewriter.Fail(logger, "Could not decrypt secrets", err)
+		}
+		environment = overrideEnvironment(environment, values)
+	}
+
+	// 2) Run command
+	executable, err := exec.LookPath(args[0])
+	if err != nil {
+		typewriter.Fail(logger, "Could not find command", err)
+	}
+
+	if err := syscall.Exec(executable, args, environment); err != nil {
+		typewriter.Fail(logger, "Could not run command", err)
+	}
+}
+
+// overrideEnvironment returns the given environment (KEY=value) where all variables are replaced
+// by the given overrides. Variables which do not exist yet are appended.
+func overrideEnvironment(environment, overrides []string) []string {
+	keys := make(map[string]bool)
+	for _, override := range overrides {
+		keys[strings.SplitN(override, "=", 2)[0]] = true
+	}
+
+	result := make([]string, 0, len(environment)+len(overrides))
+	for _, variable := range environment {
+		if !keys[strings.SplitN(variable, "=", 2)[0]] {
+			result = append(result, variable)
+		}
+	}
+	return append(result, overrides...)
+}
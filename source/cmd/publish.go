@@ -3,12 +3,11 @@ package cmd
 import (
 	"context"
 	"fmt"
-	"path/filepath"
+	"strings"
 
 	"github.com/spf13/cobra"
 	"go.borchero.com/cuckoo/providers/cdn"
 	"go.borchero.com/cuckoo/providers/storage"
-	"go.borchero.com/cuckoo/utils"
 	"go.borchero.com/typewriter"
 )
 
@@ -16,22 +15,107 @@ const publishDescription = `
 The publish command can be used to push a directory containing files to some object storage bucket.
 The intended use case for this command is to publish the contents of the bucket as a website.
 
-Currently, the publish command enables pushing to an AWS S3 or Google Cloud Storage bucket.
+Currently, the publish command enables pushing to an AWS S3 or Google Cloud Storage bucket or an
+Azure Blob Storage container. For Azure, the storage account and its key are read from the
+environment variables AZURE_STORAGE_ACCOUNT and AZURE_STORAGE_KEY. Using --endpoint, S3-compatible
+services such as MinIO, Ceph or Cloudflare R2 can be used (usually along with --s3-path-style).
 Additionally, it enables invalidating an AWS Cloudfront cache if the AWS S3 bucket is served via
-Cloudfront to enable CDN caching and TLS support.
+Cloudfront to enable CDN caching and TLS support. Using the 'file' provider, files are copied to
+a local directory given as bucket (e.g. 'file://public') which is useful for testing.
+
+Using --purge, objects which are not present locally are removed. The --prefix denotes a directory
+(a trailing slash is appended if missing) and only objects within this directory are ever
+considered, i.e. objects outside of it (e.g. 'docs-old/' for the prefix 'docs') are never removed.
+
+Only files whose contents differ from the existing objects (compared by size and MD5 or CRC32C
+checksum) or whose attributes (e.g. headers set by --rules) changed are uploaded. A hash of the
+attributes is stored in the objects' metadata. Use --force to upload all files. The cache is only
+invalidated if any object changed.
+
+Using --rules, headers and metadata of published objects can be set per file. All rules matching
+a file are applied in order. Patterns without a slash match file names, '**' matches any number
+of directories. Files may be compressed before uploading (gzip/br), setting Content-Encoding:
+
+	rules:
+	  - match: "**"
+	    cacheControl: public, max-age=31536000, immutable
+	  - match: "*.html"
+	    cacheControl: no-cache
+	    compress: gzip
+	  - match: "downloads/**"
+	    contentDisposition: attachment
+	    metadata:
+	      team: docs
+
+Using --website, redirects and the website configuration of the bucket can be given:
+
+	indexDocument: index.html     # served for paths ending with a slash
+	errorDocument: 404.html       # served for paths which do not exist
+	fallback: index.html          # error document for single-page apps, i.e. '/*' => '/index.html'
+	redirects:
+	  - from: /old/page.html
+	    to: /new/page.html
+	  - from: /blog/
+	    to: https://blog.example.com/
+
+Redirects are published as pages redirecting visitors. On S3, they additionally set the
+x-amz-website-redirect-location header which is used by S3 website endpoints. Index and error
+document are configured for S3 and GCS buckets, other website settings (e.g. S3 routing rules) are
+kept. Error documents (including the fallback) are served with status 404. Both are relative to
+--prefix. For releases, the error document is located in the current release: it is updated when
+switching releases, also when rolling back.
+
+Content types are determined from file extensions. Files with unknown extensions are inspected to
+detect their content type. Use --mime-type to override the content type of an extension.
+
+Using --release, the directory is published as a new release to '<prefix>releases/<version>/'
+such that visitors never see a partially updated website. Once all files have been uploaded, a
+pointer is switched to serve the new release (--pointer):
+
+	cloudfront  Sets the origin path of the Cloudfront distribution to the release's directory,
+	            waits until the distribution is deployed and invalidates the cache. Deploying
+	            usually takes a few minutes. Use --aws-cloudfront-origin if the distribution has
+	            multiple origins.
+	redirect    Uploads '<prefix>index.html' which redirects visitors to the release's directory.
+
+Only the newest releases are kept (--keep). Versions of kept releases cannot be published again.
+The 'rollback' subcommand switches back to a previous release.
 `
 
-type void struct{}
+const publishRollbackDescription = `
+The rollback command switches a website published with --release back to a previous release. If
+no release is given via --to, it switches to the release published before the current one. The
+same pointer as for publishing must be used. Switching only updates the pointer, no files are
+uploaded. Using the redirect pointer, the previous release is served immediately. Using the
+cloudfront pointer, the command waits until the updated distribution is deployed to all edge
+locations, which usually takes a few minutes, and invalidates the cache afterwards.
+`
+
+// storageEndpoint describes a custom endpoint of a storage provider.
+type storageEndpoint struct {
+	url       string
+	pathStyle bool
+}
 
 var publishArgs struct {
 	dir             string
 	provider        string
 	bucket          string
+	endpoint        storageEndpoint
 	prefix          string
 	purge           bool
+	force           bool
+	rules           string
+	website         string
+	mimeTypes       []string
+	release         string
+	keep            int
+	pointer         string
+	rollbackTo      string
 	cloudfrontCache struct {
-		name string
-		path string
+		name   string
+		path   string
+		origin string
 	}
 }
 
@@ -48,34 +132,83 @@ func init() {
 		&publishArgs.dir, "dir", "d", ".",
 		"The directory from which to get files to upload.",
 	)
-	publishCommand.Flags().StringVarP(
+	publishCommand.PersistentFlags().StringVarP(
 		&publishArgs.bucket, "bucket", "b", "",
 		"The bucket to which the files should be uploaded.",
 	)
 
-	publishCommand.Flags().StringVar(
+	publishCommand.PersistentFlags().StringVar(
 		&publishArgs.provider, "provider", "s3",
-		"The provider to use to access the bucket (s3/gcs).",
+		"The provider to use to access the bucket (s3/gcs/azure/file).",
 	)
-	publishCommand.Flags().StringVar(
+	addStorageEndpointFlags(publishCommand, &publishArgs.endpoint)
+	publishCommand.PersistentFlags().StringVar(
 		&publishArgs.prefix, "prefix", "",
-		"The prefix to use for storing paths in the bucket.",
+		"The directory in the bucket to store files in.",
 	)
 
 	publishCommand.Flags().BoolVar(
 		&publishArgs.purge, "purge", false,
 		"Whether to remove files from the bucket which are not present locally.",
 	)
+	publishCommand.Flags().StringVar(
+		&publishArgs.rules, "rules", "",
+		"A YAML file with rules for setting headers and metadata of published files.",
+	)
+	publishCommand.Flags().StringVar(
+		&publishArgs.website, "website", "",
+		"A YAML file with redirects and the index and error documents of the website.",
+	)
+	publishCommand.Flags().StringArrayVar(
+		&publishArgs.mimeTypes, "mime-type", []string{},
+		"A content type for all files with some extension, e.g. '.md=text/plain'.",
+	)
+	publishCommand.Flags().BoolVar(
+		&publishArgs.force, "force", false,
+		"Whether to upload all files, even if they did not change.",
+	)
 
 	publishCommand.Flags().StringVar(
+		&publishArgs.release, "release", "",
+		"The version to publish the files as. Files are published in place if not set.",
+	)
+	publishCommand.Flags().IntVar(
+		&publishArgs.keep, "keep", 5,
+		"The number of releases to keep. All releases are kept if set to 0.",
+	)
+	publishCommand.PersistentFlags().StringVar(
+		&publishArgs.pointer, "pointer", "",
+		"The pointer to the current release (cloudfront/redirect). Defaults to cloudfront if a "+
+			"Cloudfront distribution is given.",
+	)
+
+	publishCommand.PersistentFlags().StringVar(
 		&publishArgs.cloudfrontCache.name, "aws-cloudfront-distribution", "",
 		"The name of an AWS Cloudfront cache to invalidate after publishing.",
 	)
-	publishCommand.Flags().StringVar(
+	publishCommand.PersistentFlags().StringVar(
 		&publishArgs.cloudfrontCache.path, "aws-cloudfront-path", "/*",
 		"The paths to invalidate after publishing.",
 	)
+	publishCommand.PersistentFlags().StringVar(
+		&publishArgs.cloudfrontCache.origin, "aws-cloudfront-origin", "",
+		"The ID of the Cloudfront origin pointing to the current release.",
+	)
+
+	rollbackCommand := &cobra.Command{
+		Use:   "rollback",
+		Short: "Switch a website published as releases back to a previous release.",
+		Long:  publishRollbackDescription,
+		Args:  cobra.ExactArgs(0),
+		Run:   runPublishRollback,
+	}
+
+	rollbackCommand.Flags().StringVar(
+		&publishArgs.rollbackTo, "to", "",
+		"The release to switch to. Defaults to the release before the current one.",
+	)
 
+	publishCommand.AddCommand(rollbackCommand)
 	rootCmd.AddCommand(publishCommand)
 }
 
@@ -89,93 +222,210 @@ func runPublish(cmd *cobra.Command, args []string) {
 	if publishArgs.bucket == "" {
 		typewriter.Fail(logger, "Bucket must be given", nil)
 	}
+	publishArgs.prefix = storage.NormalizePrefix(publishArgs.prefix)
 
 	// 2) Get storage provider
-	var provider storage.Provider
-	var err error = fmt.Errorf("Storage provider %s does not exist", publishArgs.provider)
-	if publishArgs.provider == "s3" {
-		provider, err = storage.NewS3(publishArgs.bucket, logger)
-	} else if publishArgs.provider == "gcs" {
-		provider, err = storage.NewGCS(context.Background(), publishArgs.bucket, logger)
-	}
+	provider, err := newStorageProvider(
+		publishArgs.provider, publishArgs.bucket, publishArgs.endpoint, logger,
+	)
 	if err != nil {
 		typewriter.Fail(logger, "Failed to get storage provider", err)
 	}
 
-	// 3) Get objects to upload
-	publishArgs.dir = filepath.Clean(publishArgs.dir)
+	// 3) Register content types
+	for _, spec := range publishArgs.mimeTypes {
+		parts := strings.SplitN(spec, "=", 2)
+		if len(parts) != 2 {
+			typewriter.Fail(logger, fmt.Sprintf("Content type '%s' has wrong format", spec), nil)
+		}
+		if err := storage.SetMimeType(parts[0], parts[1]); err != nil {
+			typewriter.Fail(logger, "Invalid content type", err)
+		}
+	}
 
-	// 3.1) Iterate over directory
-	files, err := utils.GetMatchingFiles(".*", publishArgs.dir)
-	if err != nil {
-		typewriter.Fail(logger, "Unable to get files of provided directory", err)
+	// 4) Read configuration files
+	// 4.1) Read rules
+	var rules *storage.PublishRulesFile
+	if publishArgs.rules != "" {
+		rules, err = storage.ReadPublishRulesFile(publishArgs.rules)
+		if err != nil {
+			typewriter.Fail(logger, "Failed to read rules", err)
+		}
 	}
 
-	// 3.2) Get transfer objects
-	transfer := make([]storage.TransferObject, len(files))
-	bucketPaths := make(map[string]void)
+	// 4.2) Read website configuration
+	var website *storage.WebsiteFile
+	if publishArgs.website != "" {
+		website, err = storage.ReadWebsiteFile(publishArgs.website)
+		if err != nil {
+			typewriter.Fail(logger, "Failed to read website configuration", err)
+		}
+	}
 
-	for i, file := range files {
-		relPath, err := filepath.Rel(publishArgs.dir, filepath.Clean(file))
+	// 5) Publish
+	options := storage.PublishOptions{
+		Dir:     publishArgs.dir,
+		Prefix:  publishArgs.prefix,
+		Rules:   rules,
+		Website: website,
+		Force:   publishArgs.force,
+		Purge:   publishArgs.purge,
+	}
+	changed := true
+	if publishArgs.release == "" {
+		plan, err := storage.Publish(provider, options, logger)
 		if err != nil {
-			typewriter.Fail(logger, "Unexpected error occurred", err)
+			typewriter.Fail(logger, "Failed to publish files", err)
+		}
+		changed = len(plan.Upload) > 0 || len(plan.Delete) > 0
+
+		if website != nil {
+			config := website.Config(publishArgs.prefix)
+			if err := storage.ConfigureWebsite(provider, config, logger); err != nil {
+				typewriter.Fail(logger, "Failed to configure website", err)
+			}
 		}
-		bucketPath := publishArgs.prefix + relPath
-		transfer[i] = storage.TransferObject{
-			LocalPath:  file,
-			BucketPath: bucketPath,
+	} else {
+		site := newVersionedSite(provider, logger)
+		site.Website = website
+		if err := site.Publish(publishArgs.release, options, publishArgs.keep); err != nil {
+			typewriter.Fail(logger, "Failed to publish release", err)
 		}
-		bucketPaths[bucketPath] = void{}
 	}
 
-	// 4) Upload transfer objects
-	if err := provider.Upload(transfer...); err != nil {
-		typewriter.Fail(logger, "Failed to upload objects", err)
+	// 6) Invalidate cache if needed (the Cloudfront pointer invalidates the cache itself)
+	if changed && (publishArgs.release == "" || publishArgs.pointer != "cloudfront") {
+		invalidateCloudfront(logger)
 	}
 
-	// 5) Invalidate cache if needed
-	if publishArgs.cloudfrontCache.name != "" {
-		logger.Infof("Creating invalidation...")
+	logger.Success("Done 🎉")
+}
 
-		// 5.1) Get provider
-		cdnProvider, err := cdn.NewCloudfront(publishArgs.cloudfrontCache.name)
-		if err != nil {
-			typewriter.Fail(logger, "Failed to get CDN provider", err)
-		}
+func runPublishRollback(cmd *cobra.Command, args []string) {
+	logger := typewriter.NewCLILogger()
 
-		// 5.2) Invalidate
-		if err := cdnProvider.Invalidate(publishArgs.cloudfrontCache.path); err != nil {
-			typewriter.Fail(logger, "Failed to invalidate CDN paths", err)
-		}
+	// 1) Verify parameters
+	if publishArgs.bucket == "" {
+		typewriter.Fail(logger, "Bucket must be given", nil)
 	}
+	publishArgs.prefix = storage.NormalizePrefix(publishArgs.prefix)
 
-	// 6) Purge old items if needed
-	if publishArgs.purge {
-		logger.Infof("Now purging objects...")
+	// 2) Get storage provider
+	provider, err := newStorageProvider(
+		publishArgs.provider, publishArgs.bucket, publishArgs.endpoint, logger,
+	)
+	if err != nil {
+		typewriter.Fail(logger, "Failed to get storage provider", err)
+	}
 
-		// 6.1) List existing
-		existing, err := provider.List()
-		if err != nil {
-			typewriter.Fail(logger, "Failed to list objects for purging", err)
+	// 3) Roll back
+	site := newVersionedSite(provider, logger)
+	version, err := site.Rollback(publishArgs.rollbackTo)
+	if err != nil {
+		typewriter.Fail(logger, "Failed to roll back", err)
+	}
+
+	// 4) Invalidate cache if needed
+	if publishArgs.pointer != "cloudfront" {
+		invalidateCloudfront(logger)
+	}
+
+	logger.Infof("Release '%s' is now current", version)
+	logger.Success("Done 🎉")
+}
+
+// newVersionedSite returns the versioned site at the publish prefix, using the pointer given by
+// the flags. It fails if the pointer cannot be used.
+func newVersionedSite(
+	provider storage.Provider, logger typewriter.CLILogger,
+) *storage.VersionedSite {
+	site := &storage.VersionedSite{
+		Provider: provider,
+		Prefix:   publishArgs.prefix,
+		Logger:   logger,
+	}
+
+	if publishArgs.pointer == "" {
+		publishArgs.pointer = "redirect"
+		if publishArgs.cloudfrontCache.name != "" {
+			publishArgs.pointer = "cloudfront"
 		}
+	}
 
-		// 6.2) Find the ones which are not present anymore
-		removals := make([]string, 0)
-		for _, path := range existing {
-			if _, ok := bucketPaths[path]; !ok {
-				removals = append(removals, path)
+	switch publishArgs.pointer {
+	case "redirect":
+		site.Pointer = storage.RedirectIndexPointer
+	case "cloudfront":
+		if publishArgs.cloudfrontCache.name == "" {
+			typewriter.Fail(logger, "Cloudfront distribution must be given for this pointer", nil)
+		}
+		cdnProvider, err := cdn.NewCloudfront(publishArgs.cloudfrontCache.name)
+		if err != nil {
+			typewriter.Fail(logger, "Failed to get CDN provider", err)
+		}
+		site.Pointer = func(site *storage.VersionedSite, version string) error {
+			path := "/" + strings.TrimSuffix(site.ReleasePath(version), "/")
+			logger.Info("Updating Cloudfront distribution, this may take a few minutes...")
+			err := cdnProvider.SetOriginPath(publishArgs.cloudfrontCache.origin, path)
+			if err != nil {
+				return err
 			}
+			return cdnProvider.Invalidate(publishArgs.cloudfrontCache.path)
 		}
+	default:
+		typewriter.Fail(
+			logger, fmt.Sprintf("Pointer '%s' does not exist", publishArgs.pointer), nil,
+		)
+	}
+	return site
+}
 
-		if len(removals) == 0 {
-			logger.Infof("Nothing to purge")
-		}
+// invalidateCloudfront invalidates the Cloudfront cache given by the flags, if any.
+func invalidateCloudfront(logger typewriter.CLILogger) {
+	if publishArgs.cloudfrontCache.name == "" {
+		return
+	}
+	logger.Infof("Creating invalidation...")
 
-		// 6.3) Remove
-		if err := provider.Delete(removals...); err != nil {
-			typewriter.Fail(logger, "Failed to purge objects", err)
-		}
+	// 1) Get provider
+	cdnProvider, err := cdn.NewCloudfront(publishArgs.cloudfrontCache.name)
+	if err != nil {
+		typewriter.Fail(logger, "Failed to get CDN provider", err)
 	}
 
-	logger.Success("Done 🎉")
+	// 2) Invalidate
+	if err := cdnProvider.Invalidate(publishArgs.cloudfrontCache.path); err != nil {
+		typewriter.Fail(logger, "Failed to invalidate CDN paths", err)
+	}
+}
+
+// newStorageProvider returns the storage provider with the given name for accessing the bucket.
+func newStorageProvider(
+	name, bucket string, endpoint storageEndpoint, logger typewriter.CLILogger,
+) (storage.Provider, error) {
+	switch name {
+	case "s3":
+		options := storage.S3Options{Endpoint: endpoint.url, PathStyle: endpoint.pathStyle}
+		return storage.NewS3(bucket, options, logger)
+	case "gcs":
+		return storage.NewGCS(context.Background(), bucket, logger)
+	case "azure":
+		return storage.NewAzure(bucket, endpoint.url, logger)
+	case "file":
+		return storage.NewLocal(strings.TrimPrefix(bucket, "file://"), logger)
+	default:
+		return nil, fmt.Errorf("Storage provider %s does not exist", name)
+	}
+}
+
+// addStorageEndpointFlags adds the flags for configuring a custom storage endpoint to the command.
+func addStorageEndpointFlags(command *cobra.Command, endpoint *storageEndpoint) {
+	command.PersistentFlags().StringVar(
+		&endpoint.url, "endpoint", "",
+		"The URL of a custom endpoint for S3-compatible services or Azure.",
+	)
+	command.PersistentFlags().BoolVar(
+		&endpoint.pathStyle, "s3-path-style", false,
+		"Whether to address S3 buckets via paths instead of subdomains.",
+	)
 }
@@ -0,0 +1,441 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/spf13/cobra"
+	"go.borchero.com/cuckoo/ci"
+	"go.borchero.com/cuckoo/providers"
+	"go.borchero.com/cuckoo/providers/repository"
+	"go.borchero.com/typewriter"
+)
+
+const (
+	reviewLabel             = "cuckoo.borchero.com/review"
+	reviewProjectLabel      = "cuckoo.borchero.com/project"
+	reviewBranchAnnotation  = "cuckoo.borchero.com/branch"
+	reviewReleaseAnnotation = "cuckoo.borchero.com/release"
+
+	// reviewNameMaxLength is the maximum length of namespace names (DNS labels) and label values.
+	reviewNameMaxLength = 63
+)
+
+const reviewDescription = `
+The review command manages ephemeral review environments for branches (e.g. merge requests). Each
+branch is deployed into its own namespace '<prefix><branch slug>' where the slug is given by
+CI_COMMIT_REF_SLUG. Names exceeding 63 characters are truncated and suffixed with a hash of the
+slug to remain unique. Namespaces of review environments are labeled such that environments of
+branches which no longer exist can be removed via the sweep subcommand.
+
+Make sure to be authenticated for Kubernetes or run 'cuckoo auth' prior to calling this command to
+write the kubeconfig file.
+`
+
+const reviewUpDescription = `
+The up command deploys the current branch into its review environment. The namespace is created if
+it does not exist. Charts and values are handled in the same way as by the deploy command, consult
+its documentation for details.
+
+The hostname of the review environment is generated from the template given by --host. The
+following data is available:
+
+* {{ .Slug }} and {{ .Branch }}: The slug and the name of the current branch.
+* {{ .Project }}: The slug of the project, given by CI_PROJECT_PATH_SLUG.
+* {{ .Namespace }}: The namespace of the review environment.
+
+The hostname is set as value with the key given by --host-value. Further, the URL of the
+environment is written to a dotenv file as ENVIRONMENT_URL. Use this file as GitLab dotenv report
+artifact to set the environment's URL dynamically:
+
+	review:
+	  script: cuckoo review up --host "{{ .Slug }}.review.example.com"
+	  environment:
+	    name: review/$CI_COMMIT_REF_SLUG
+	    url: $ENVIRONMENT_URL
+	    on_stop: stop-review
+	  artifacts:
+	    reports:
+	      dotenv: review.env
+`
+
+const reviewDownDescription = `
+The down command uninstalls the release of the current branch's review environment and deletes
+the environment's namespace along with all remaining resources.
+`
+
+const reviewSweepDescription = `
+The sweep command removes all review environments of the project whose branches no longer exist in
+the GitLab repository. The GitLab API is accessed via the credentials given by CI_REGISTRY_USER and
+CI_REGISTRY_PASSWORD.
+`
+
+var reviewArgs struct {
+	name      string
+	prefix    string
+	repo      string
+	chart     string
+	version   string
+	values    []string
+	set       []string
+	image     string
+	tag       string
+	host      string
+	hostValue string
+	scheme    string
+	dotenv    string
+	timeout   time.Duration
+	wait      bool
+	dryRun    bool
+}
+
+type reviewHostValues struct {
+	Slug      string
+	Branch    string
+	Project   string
+	Namespace string
+}
+
+func init() {
+	reviewCommand := &cobra.Command{
+		Use:   "review",
+		Short: "Manage ephemeral review environments for branches.",
+		Long:  reviewDescription,
+	}
+
+	reviewCommand.PersistentFlags().StringVar(
+		&reviewArgs.name, "name", env.Project.Slug,
+		"The name of the Helm release.",
+	)
+	reviewCommand.PersistentFlags().StringVar(
+		&reviewArgs.prefix, "prefix", "review-",
+		"The prefix of namespaces of review environments.",
+	)
+	reviewCommand.PersistentFlags().DurationVar(
+		&reviewArgs.timeout, "timeout", 15*time.Minute,
+		"The time to wait for any individual Kubernetes operation.",
+	)
+	reviewCommand.PersistentFlags().BoolVar(
+		&reviewArgs.dryRun, "dry-run", false,
+		"Whether to perform a dry-run.",
+	)
+
+	upCommand := &cobra.Command{
+		Use:   "up",
+		Short: "Deploy the current branch into its review environment.",
+		Long:  reviewUpDescription,
+		Args:  cobra.ExactArgs(0),
+		Run:   runReviewUp,
+	}
+
+	upCommand.Flags().StringVar(
+		&reviewArgs.repo, "repo", "",
+		"The URL to a Helm repository when using a remote chart.",
+	)
+	upCommand.Flags().StringVar(
+		&reviewArgs.chart, "chart", "./deploy/helm",
+		"The chart to deploy.",
+	)
+	upCommand.Flags().StringVar(
+		&reviewArgs.version, "version", "0.0.0",
+		"The version of the chart to deploy. Only relevant for remote and registry charts.",
+	)
+	upCommand.Flags().StringArrayVarP(
+		&reviewArgs.values, "values", "f", []string{},
+		"A path to one or multiple value files to set values from.",
+	)
+	upCommand.Flags().StringArrayVar(
+		&reviewArgs.set, "set", []string{},
+		"Values to set (key1=val1,key2=val2). Takes precedence over value files.",
+	)
+	upCommand.Flags().StringVar(
+		&reviewArgs.image, "image", "",
+		"The path for the image to deploy. Only relevant for local charts and values templates.",
+	)
+	upCommand.Flags().StringVarP(
+		&reviewArgs.tag, "tag", "t", "",
+		"The tag of the image to use for deployment. Defines appVersion of local charts.",
+	)
+	upCommand.Flags().StringVar(
+		&reviewArgs.host, "host", "",
+		"The template for the hostname of the review environment.",
+	)
+	upCommand.Flags().StringVar(
+		&reviewArgs.hostValue, "host-value", "ingress.host",
+		"The key of the value which is set to the hostname.",
+	)
+	upCommand.Flags().StringVar(
+		&reviewArgs.scheme, "scheme", "https",
+		"The scheme of the environment's URL.",
+	)
+	upCommand.Flags().StringVar(
+		&reviewArgs.dotenv, "dotenv", "review.env",
+		"The dotenv file to write the environment's URL to.",
+	)
+	upCommand.Flags().BoolVar(
+		&reviewArgs.wait, "wait", true,
+		"Whether to wait until all resources are ready before marking the release as successful.",
+	)
+
+	downCommand := &cobra.Command{
+		Use:   "down",
+		Short: "Remove the review environment of the current branch.",
+		Long:  reviewDownDescription,
+		Args:  cobra.ExactArgs(0),
+		Run:   runReviewDown,
+	}
+
+	sweepCommand := &cobra.Command{
+		Use:   "sweep",
+		Short: "Remove review environments of branches which no longer exist.",
+		Long:  reviewSweepDescription,
+		Args:  cobra.ExactArgs(0),
+		Run:   runReviewSweep,
+	}
+
+	reviewCommand.AddCommand(upCommand)
+	reviewCommand.AddCommand(downCommand)
+	reviewCommand.AddCommand(sweepCommand)
+	rootCmd.AddCommand(reviewCommand)
+}
+
+func runReviewUp(cmd *cobra.Command, args []string) {
+	logger := typewriter.NewCLILogger()
+	manager := ci.NewManager(env)
+
+	// 1) Verify parameters
+	if reviewArgs.host == "" {
+		typewriter.Fail(logger, "Host must be given", nil)
+	}
+	if env.Commit.Slug == "" {
+		typewriter.Fail(logger, "Review environments require CI_COMMIT_REF_SLUG to be set", nil)
+	}
+	namespace := reviewNamespace(reviewArgs.prefix, env.Commit.Slug)
+
+	// 2) Generate hostname
+	host, err := reviewHost(namespace)
+	if err != nil {
+		typewriter.Fail(logger, "Cannot use the specified host", err)
+	}
+
+	// 3) Ensure namespace
+	kube, err := providers.NewKubernetes()
+	if err != nil {
+		typewriter.Fail(logger, "Failed to connect to Kubernetes", err)
+	}
+
+	if !reviewArgs.dryRun {
+		labels := map[string]string{
+			reviewLabel:        "true",
+			reviewProjectLabel: reviewProject(env.Project.Slug),
+		}
+		annotations := map[string]string{
+			reviewBranchAnnotation:  env.Commit.Branch,
+			reviewReleaseAnnotation: reviewArgs.name,
+		}
+		if err := kube.EnsureNamespace(namespace, labels, annotations); err != nil {
+			typewriter.Fail(logger, "Failed to prepare namespace", err)
+		}
+	}
+
+	// 4) Deploy
+	release, err := providers.NewHelmRelease(
+		reviewArgs.repo, reviewArgs.chart, reviewArgs.version,
+		reviewArgs.name, namespace, logger,
+	)
+	if err != nil {
+		typewriter.Fail(logger, "Failed to prepare deployment", err)
+	}
+
+	image, err := manager.ImageNameFromTemplate(reviewArgs.image)
+	if err != nil {
+		typewriter.Fail(logger, "Cannot use the specified image", err)
+	}
+
+	tag, err := manager.TagFromTemplate(reviewArgs.tag)
+	if err != nil {
+		typewriter.Fail(logger, "Cannot use the specified tag", err)
+	}
+
+	values := providers.HelmValues{
+		Files:        reviewArgs.values,
+		Values:       reviewArgs.set,
+		StringValues: []string{fmt.Sprintf("%s=%s", reviewArgs.hostValue, host)},
+		Image:        image,
+		Tag:          tag,
+		Commit:       helmCommit(),
+	}
+	options := providers.HelmUpgradeOptions{
+		Timeout: reviewArgs.timeout,
+		Wait:    reviewArgs.wait,
+		DryRun:  reviewArgs.dryRun,
+	}
+	if err := release.Upgrade(values, options); err != nil {
+		typewriter.Fail(logger, "Failed to deploy", err)
+	}
+
+	// 5) Write dotenv file
+	url := fmt.Sprintf("%s://%s", reviewArgs.scheme, host)
+	dotenv := fmt.Sprintf("ENVIRONMENT_URL=%s\n", url)
+	if err := ioutil.WriteFile(reviewArgs.dotenv, []byte(dotenv), 0644); err != nil {
+		typewriter.Fail(logger, "Failed to write dotenv file", err)
+	}
+
+	logger.Infof("Review environment available at %s", url)
+	logger.Success("Done 🎉")
+}
+
+func runReviewDown(cmd *cobra.Command, args []string) {
+	logger := typewriter.NewCLILogger()
+
+	// 1) Verify parameters
+	if env.Commit.Slug == "" {
+		typewriter.Fail(logger, "Review environments require CI_COMMIT_REF_SLUG to be set", nil)
+	}
+
+	// 2) Remove environment
+	kube, err := providers.NewKubernetes()
+	if err != nil {
+		typewriter.Fail(logger, "Failed to connect to Kubernetes", err)
+	}
+
+	namespace := reviewNamespace(reviewArgs.prefix, env.Commit.Slug)
+	if err := removeReviewEnvironment(kube, namespace, reviewArgs.name, logger); err != nil {
+		typewriter.Fail(logger, "Failed to remove review environment", err)
+	}
+
+	logger.Success("Done 🎉")
+}
+
+func runReviewSweep(cmd *cobra.Command, args []string) {
+	logger := typewriter.NewCLILogger()
+
+	// 1) Get existing branches
+	repo, err := repository.NewGitlabRepo(
+		env.GitlabHost, env.Registry.User, env.Registry.Password, env.Project.ID,
+	)
+	if err != nil {
+		typewriter.Fail(logger, "Failed to connect to GitLab", err)
+	}
+
+	branches, err := repo.Branches()
+	if err != nil {
+		typewriter.Fail(logger, "Failed to list branches", err)
+	}
+
+	existing := make(map[string]bool)
+	for _, branch := range branches {
+		existing[branch] = true
+	}
+
+	// 2) Get review environments
+	kube, err := providers.NewKubernetes()
+	if err != nil {
+		typewriter.Fail(logger, "Failed to connect to Kubernetes", err)
+	}
+
+	selector := fmt.Sprintf(
+		"%s=true,%s=%s", reviewLabel, reviewProjectLabel, reviewProject(env.Project.Slug),
+	)
+	namespaces, err := kube.ListNamespaces(selector)
+	if err != nil {
+		typewriter.Fail(logger, "Failed to list review environments", err)
+	}
+
+	// 3) Remove environments of deleted branches
+	for _, namespace := range namespaces {
+		branch := namespace.Annotations[reviewBranchAnnotation]
+		if branch == "" || existing[branch] {
+			continue
+		}
+
+		logger.Infof("Branch '%s' does not exist anymore", branch)
+		release := namespace.Annotations[reviewReleaseAnnotation]
+		err := removeReviewEnvironment(kube, namespace.Name, release, logger)
+		if err != nil {
+			typewriter.Fail(logger, "Failed to remove review environment", err)
+		}
+	}
+
+	logger.Success("Done 🎉")
+}
+
+// reviewNamespace returns the namespace of the review environment of the branch with the given
+// slug. If the name is too long for a namespace, it is truncated and suffixed with a short hash of
+// the slug such that names of different branches do not collide.
+func reviewNamespace(prefix, slug string) string {
+	return truncateReviewName(prefix+slug, slug)
+}
+
+// reviewProject returns the value of the project label of review environments, truncated in the
+// same way as namespaces if the project's slug is too long for a label value.
+func reviewProject(slug string) string {
+	return truncateReviewName(slug, slug)
+}
+
+// truncateReviewName truncates the given name if it exceeds the maximum length and suffixes it
+// with a short hash of the given value.
+func truncateReviewName(name, hashed string) string {
+	if len(name) <= reviewNameMaxLength {
+		return name
+	}
+
+	checksum := sha256.Sum256([]byte(hashed))
+	hash := hex.EncodeToString(checksum[:])[:8]
+	truncated := name[:reviewNameMaxLength-len(hash)-1]
+	return fmt.Sprintf("%s-%s", strings.TrimRight(truncated, "-"), hash)
+}
+
+// reviewHost expands the template of the review environment's hostname.
+func reviewHost(namespace string) (string, error) {
+	tmpl, err := template.New("host").Parse(reviewArgs.host)
+	if err != nil {
+		return "", err
+	}
+
+	values := reviewHostValues{
+		Slug:      env.Commit.Slug,
+		Branch:    env.Commit.Branch,
+		Project:   env.Project.Slug,
+		Namespace: namespace,
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, values); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// removeReviewEnvironment uninstalls the release (if given) from the namespace and deletes the
+// namespace afterwards.
+func removeReviewEnvironment(
+	kube *providers.Kubernetes, namespace, name string, logger typewriter.CLILogger,
+) error {
+	logger.Infof("Removing review environment '%s'...", namespace)
+	if reviewArgs.dryRun {
+		return nil
+	}
+
+	// 1) Uninstall release
+	if name != "" {
+		release, err := providers.NewHelmRelease("", "", "", name, namespace, logger)
+		if err != nil {
+			return err
+		}
+
+		options := providers.HelmUpgradeOptions{Timeout: reviewArgs.timeout}
+		if err := release.Uninstall(options); err != nil {
+			return err
+		}
+	}
+
+	// 2) Delete namespace
+	return kube.DeleteNamespace(namespace)
+}
@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestReviewNamespace(t *testing.T) {
+	// Short names are kept
+	assert.Equal(t, reviewNamespace("review-", "feature-x"), "review-feature-x")
+
+	// Long names are truncated and hashed
+	slug := strings.Repeat("a", 55) + "-" + strings.Repeat("b", 7)
+	namespace := reviewNamespace("review-", slug)
+	assert.Equal(t, len(namespace), 63)
+	assert.Assert(t, strings.HasPrefix(namespace, "review-aaaa"), namespace)
+	assert.Equal(t, namespace, reviewNamespace("review-", slug), "Names are not deterministic.")
+
+	// Truncation must not yield trailing dashes
+	slug = strings.Repeat("a", 46) + "-" + strings.Repeat("b", 20)
+	namespace = reviewNamespace("review-", slug)
+	assert.Assert(t, len(namespace) < 63, namespace)
+	assert.Assert(t, !strings.Contains(namespace, "--"), namespace)
+
+	// Branches sharing a long prefix get different namespaces
+	other := reviewNamespace("review-", slug+"c")
+	assert.Assert(t, namespace != other, "Namespaces of different branches collide.")
+	assert.Equal(t, namespace[:54], other[:54])
+}
+
+func TestReviewProject(t *testing.T) {
+	// Short slugs are kept
+	assert.Equal(t, reviewProject("group-project"), "group-project")
+
+	// Long slugs are truncated and hashed to be valid label values
+	slug := strings.Repeat("group-", 10) + "project"
+	project := reviewProject(slug)
+	assert.Assert(t, len(project) <= 63, project)
+	assert.Assert(t, strings.HasPrefix(project, "group-group-"), project)
+	assert.Assert(t, project != reviewProject(slug+"s"), "Projects collide.")
+}
@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"time"
+
+	"github.com/spf13/cobra"
+	"go.borchero.com/cuckoo/providers"
+	"go.borchero.com/typewriter"
+)
+
+const rollbackDescription = `
+The rollback command rolls back a release to a previous revision. By default, the release is rolled
+back to the revision prior to the current one. A rollback creates a new revision itself.
+
+Releases deployed from Helm charts are rolled back via Helm. Releases deployed via --manifests or
+--kustomize must be rolled back with the --manifests flag set: the manifests stored for the target
+revision are re-applied and resources which are not part of them anymore are pruned.
+
+Make sure to be authenticated for Kubernetes or run 'cuckoo auth' prior to calling this command to
+write the kubeconfig file.
+`
+
+var rollbackArgs struct {
+	name       string
+	namespace  string
+	revision   int
+	manifests  bool
+	timeout    time.Duration
+	wait       bool
+	maxHistory int
+	dryRun     bool
+}
+
+func init() {
+	rollbackCommand := &cobra.Command{
+		Use:   "rollback",
+		Short: "Roll back a release to a previous revision.",
+		Long:  rollbackDescription,
+		Args:  cobra.ExactArgs(0),
+		Run:   runRollback,
+	}
+
+	rollbackCommand.Flags().StringVar(
+		&rollbackArgs.name, "name", env.Project.Slug,
+		"The name of the release.",
+	)
+	rollbackCommand.Flags().StringVarP(
+		&rollbackArgs.namespace, "namespace", "n", "default",
+		"The namespace of the release.",
+	)
+	rollbackCommand.Flags().IntVar(
+		&rollbackArgs.revision, "revision", 0,
+		"The revision to roll back to (0 for the previous revision).",
+	)
+	rollbackCommand.Flags().BoolVar(
+		&rollbackArgs.manifests, "manifests", false,
+		"Whether the release was deployed from plain manifests or a Kustomize overlay.",
+	)
+	rollbackCommand.Flags().DurationVar(
+		&rollbackArgs.timeout, "timeout", 15*time.Minute,
+		"The time to wait for any individual Kubernetes operation.",
+	)
+	rollbackCommand.Flags().BoolVar(
+		&rollbackArgs.wait, "wait", true,
+		"Whether to wait until all resources are ready before marking the rollback as successful.",
+	)
+	rollbackCommand.Flags().IntVar(
+		&rollbackArgs.maxHistory, "max-history", 10,
+		"The maximum number of revisions to keep for the release (0 for no limit).",
+	)
+	rollbackCommand.Flags().BoolVar(
+		&rollbackArgs.dryRun, "dry-run", false,
+		"Whether to perform a dry-run.",
+	)
+
+	rootCmd.AddCommand(rollbackCommand)
+}
+
+func runRollback(cmd *cobra.Command, args []string) {
+	logger := typewriter.NewCLILogger()
+
+	// 1) Roll back manifests
+	if rollbackArgs.manifests {
+		release, err := providers.NewManifestRelease(
+			rollbackArgs.name, rollbackArgs.namespace, logger,
+		)
+		if err != nil {
+			typewriter.Fail(logger, "Failed to prepare rollback", err)
+		}
+
+		err = release.Rollback(rollbackArgs.revision, rollbackArgs.maxHistory, rollbackArgs.dryRun)
+		if err != nil {
+			typewriter.Fail(logger, "Failed to roll back", err)
+		}
+
+		logger.Success("Done 🎉")
+		return
+	}
+
+	// 2) Otherwise, roll back Helm release
+	release, err := providers.NewHelmRelease(
+		"", "", "", rollbackArgs.name, rollbackArgs.namespace, logger,
+	)
+	if err != nil {
+		typewriter.Fail(logger, "Failed to prepare rollback", err)
+	}
+
+	options := providers.HelmUpgradeOptions{
+		Timeout:    rollbackArgs.timeout,
+		Wait:       rollbackArgs.wait,
+		MaxHistory: rollbackArgs.maxHistory,
+		DryRun:     rollbackArgs.dryRun,
+	}
+	if err := release.Rollback(rollbackArgs.revision, options); err != nil {
+		typewriter.Fail(logger, "Failed to roll back", err)
+	}
+
+	logger.Success("Done 🎉")
+}
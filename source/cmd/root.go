@@ -7,11 +7,20 @@ import (
 
 var env = ci.ReadEnvironment()
 
+var configFile string
+
 var rootCmd = &cobra.Command{
 	Use:   "cuckoo",
 	Short: "Efficient CI/CD for GitLab CI and Kubernetes.",
 }
 
+func init() {
+	rootCmd.PersistentFlags().StringVar(
+		&configFile, "config", ".cuckoo.yaml",
+		"The config file from which to read default values for flags.",
+	)
+}
+
 // Execute runs the root command of the CLI.
 func Execute() error {
 	return rootCmd.Execute()
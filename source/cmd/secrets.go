@@ -0,0 +1,185 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+
+	"github.com/spf13/cobra"
+	"go.borchero.com/cuckoo/providers"
+	"go.borchero.com/cuckoo/utils"
+	"go.borchero.com/typewriter"
+)
+
+const secretsDescription = `
+The secrets command bundles subcommands to maintain Sops-encrypted files. All subcommands
+recursively scan the current directory and all of its subdirectories for encrypted files matching
+a particular pattern (in the same way as the decrypt command) and modify them in place. The format
+of each file is detected from its name in the same way as for the decrypt command, use --format to
+set it explicitly.
+`
+
+const secretsRotateDescription = `
+The rotate command re-encrypts all matching files with a new data key. Optionally, master keys may
+be added or removed at the same time. Added keys are put into the first key group. Use this command
+after a secret might have been leaked or a team member with access to the keys left.
+`
+
+const secretsUpdateKeysDescription = `
+The updatekeys command updates the master keys of all matching files to the keys defined by the
+creation rules of the Sops config file (.sops.yaml). The data key is not changed. Use this command
+after changing the recipients in the Sops config file, e.g. after team changes.
+`
+
+var secretsArgs struct {
+	inputPattern string
+	format       string
+	sopsConfig   string
+	add          providers.SopsKeys
+	remove       providers.SopsKeys
+}
+
+func init() {
+	secretsCommand := &cobra.Command{
+		Use:   "secrets",
+		Short: "Maintain Sops-encrypted files.",
+		Long:  secretsDescription,
+	}
+
+	secretsCommand.PersistentFlags().StringVarP(
+		&secretsArgs.inputPattern, "decrypt", "d", "^(.*)\\.enc\\.(.*)$",
+		"The regex to apply for matching encrypted files.",
+	)
+	secretsCommand.PersistentFlags().StringVar(
+		&secretsArgs.format, "format", "",
+		"The format of all files (yaml, json, ini, dotenv or binary). Detected if not given.",
+	)
+
+	rotateCommand := &cobra.Command{
+		Use:   "rotate",
+		Short: "Re-encrypt encrypted files with a new data key.",
+		Long:  secretsRotateDescription,
+		Args:  cobra.ExactArgs(0),
+		Run:   runSecretsRotate,
+	}
+
+	rotateCommand.Flags().StringArrayVar(
+		&secretsArgs.add.PGP, "add-pgp", []string{},
+		"PGP fingerprints to add as master keys (comma-separated).",
+	)
+	rotateCommand.Flags().StringArrayVar(
+		&secretsArgs.add.Age, "add-age", []string{},
+		"Age recipients to add as master keys (comma-separated).",
+	)
+	rotateCommand.Flags().StringArrayVar(
+		&secretsArgs.add.KMS, "add-kms", []string{},
+		"AWS KMS ARNs to add as master keys (comma-separated).",
+	)
+	rotateCommand.Flags().StringArrayVar(
+		&secretsArgs.add.GCPKMS, "add-gcp-kms", []string{},
+		"GCP KMS resource IDs to add as master keys (comma-separated).",
+	)
+	rotateCommand.Flags().StringArrayVar(
+		&secretsArgs.remove.PGP, "rm-pgp", []string{},
+		"PGP fingerprints to remove from the master keys (comma-separated).",
+	)
+	rotateCommand.Flags().StringArrayVar(
+		&secretsArgs.remove.Age, "rm-age", []string{},
+		"Age recipients to remove from the master keys (comma-separated).",
+	)
+	rotateCommand.Flags().StringArrayVar(
+		&secretsArgs.remove.KMS, "rm-kms", []string{},
+		"AWS KMS ARNs to remove from the master keys (comma-separated).",
+	)
+	rotateCommand.Flags().StringArrayVar(
+		&secretsArgs.remove.GCPKMS, "rm-gcp-kms", []string{},
+		"GCP KMS resource IDs to remove from the master keys (comma-separated).",
+	)
+
+	updateKeysCommand := &cobra.Command{
+		Use:   "updatekeys",
+		Short: "Update the master keys of encrypted files from the Sops config file.",
+		Long:  secretsUpdateKeysDescription,
+		Args:  cobra.ExactArgs(0),
+		Run:   runSecretsUpdateKeys,
+	}
+
+	updateKeysCommand.Flags().StringVar(
+		&secretsArgs.sopsConfig, "sops-config", "",
+		"The Sops config file. Searched in the current directory and its parents if not given.",
+	)
+
+	secretsCommand.AddCommand(rotateCommand)
+	secretsCommand.AddCommand(updateKeysCommand)
+	rootCmd.AddCommand(secretsCommand)
+}
+
+func runSecretsRotate(cmd *cobra.Command, args []string) {
+	logger := typewriter.NewCLILogger()
+
+	// 1) Get all files matching pattern
+	matches, err := utils.GetMatchingFilesSkipping(secretsArgs.inputPattern, ".", defaultSkipDirs)
+	if err != nil {
+		typewriter.Fail(logger, "Could not find any files", err)
+	}
+
+	// 2) Rotate all files
+	sops := providers.NewSops()
+	if err := sops.SetFormat(secretsArgs.format); err != nil {
+		typewriter.Fail(logger, "Invalid format", err)
+	}
+	for _, file := range matches {
+		logger.Infof("Rotating '%s'...", file)
+		contents, err := sops.Rotate(file, secretsArgs.add, secretsArgs.remove)
+		if err != nil {
+			typewriter.Fail(logger, "Could not rotate file", err)
+		}
+
+		if err := writeInPlace(file, contents); err != nil {
+			typewriter.Fail(logger, "Could not write rotated file", err)
+		}
+	}
+
+	logger.Success("Done 🎉")
+}
+
+func runSecretsUpdateKeys(cmd *cobra.Command, args []string) {
+	logger := typewriter.NewCLILogger()
+
+	// 1) Get all files matching pattern
+	matches, err := utils.GetMatchingFilesSkipping(secretsArgs.inputPattern, ".", defaultSkipDirs)
+	if err != nil {
+		typewriter.Fail(logger, "Could not find any files", err)
+	}
+
+	// 2) Update keys of all files
+	sops := providers.NewSops()
+	if err := sops.SetFormat(secretsArgs.format); err != nil {
+		typewriter.Fail(logger, "Invalid format", err)
+	}
+	for _, file := range matches {
+		contents, changed, err := sops.UpdateKeys(file, secretsArgs.sopsConfig)
+		if err != nil {
+			typewriter.Fail(logger, "Could not update keys", err)
+		}
+		if !changed {
+			logger.Infof("Keys of '%s' are up to date", file)
+			continue
+		}
+
+		logger.Infof("Updated keys of '%s'", file)
+		if err := writeInPlace(file, contents); err != nil {
+			typewriter.Fail(logger, "Could not write updated file", err)
+		}
+	}
+
+	logger.Success("Done 🎉")
+}
+
+// writeInPlace overwrites the given file with the given contents, keeping its permissions.
+func writeInPlace(file string, contents []byte) error {
+	info, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, contents, info.Mode())
+}
@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"go.borchero.com/cuckoo/providers"
+	"go.borchero.com/typewriter"
+)
+
+const statusDescription = `
+The status command reports the state of a Helm release deployed to a Kubernetes cluster. It prints
+the current revision, the chart and app version, the images used by the deployed workloads, the
+readiness of the pods for every deployment, stateful set and daemon set as well as the most recent
+entries of the release's history.
+
+The output is either human-readable or JSON (via --output json) such that it can be processed
+further. Neither kubectl nor helm need to be installed to use this command.
+
+Make sure to be authenticated for Kubernetes or run 'cuckoo auth' prior to calling this command to
+write the kubeconfig file.
+`
+
+const timeFormat = "2006-01-02 15:04:05"
+
+var statusArgs struct {
+	name      string
+	namespace string
+	history   int
+	output    string
+}
+
+func init() {
+	statusCommand := &cobra.Command{
+		Use:   "status",
+		Short: "Show the status and history of a Helm release.",
+		Long:  statusDescription,
+		Args:  cobra.ExactArgs(0),
+		Run:   runStatus,
+	}
+
+	statusCommand.Flags().StringVar(
+		&statusArgs.name, "name", env.Project.Slug,
+		"The name of the Helm release.",
+	)
+	statusCommand.Flags().StringVarP(
+		&statusArgs.namespace, "namespace", "n", "default",
+		"The namespace of the Helm release.",
+	)
+	statusCommand.Flags().IntVar(
+		&statusArgs.history, "history", 5,
+		"The number of history entries to show.",
+	)
+	statusCommand.Flags().StringVarP(
+		&statusArgs.output, "output", "o", "human",
+		"The output format (human/json).",
+	)
+
+	rootCmd.AddCommand(statusCommand)
+}
+
+func runStatus(cmd *cobra.Command, args []string) {
+	logger := typewriter.NewCLILogger()
+
+	// 1) Verify parameters
+	if statusArgs.output != "human" && statusArgs.output != "json" {
+		typewriter.Fail(logger, fmt.Sprintf("Unknown output format '%s'", statusArgs.output), nil)
+	}
+
+	// 2) Get status
+	release, err := providers.NewHelmRelease(
+		"", "", "", statusArgs.name, statusArgs.namespace, logger,
+	)
+	if err != nil {
+		typewriter.Fail(logger, "Failed to connect to release", err)
+	}
+
+	status, err := release.Status(statusArgs.history)
+	if err != nil {
+		typewriter.Fail(logger, "Failed to get release status", err)
+	}
+
+	// 3) Print status
+	if statusArgs.output == "json" {
+		marshalled, err := json.MarshalIndent(status, "", "  ")
+		if err != nil {
+			typewriter.Fail(logger, "Failed to encode status", err)
+		}
+		fmt.Println(string(marshalled))
+		return
+	}
+
+	logger.Infof("Release %s (namespace %s)", status.Name, status.Namespace)
+	logger.Infof(" - revision: %d", status.Revision)
+	logger.Infof(" - status: %s", status.Status)
+	logger.Infof(" - chart: %s-%s", status.Chart, status.ChartVersion)
+	logger.Infof(" - app version: %s", status.AppVersion)
+	logger.Infof(" - last deployed: %s", status.LastDeployed.Format(timeFormat))
+	logger.Infof(" - images: [%s]", strings.Join(status.Images, ", "))
+
+	logger.Info("Workloads:")
+	if len(status.Workloads) == 0 {
+		logger.Info(" - none")
+	}
+	for _, workload := range status.Workloads {
+		if workload.Error != "" {
+			logger.Errorf(" - %s/%s: %s", workload.Kind, workload.Name, workload.Error)
+			continue
+		}
+		logger.Infof(
+			" - %s/%s: %d/%d ready", workload.Kind, workload.Name, workload.Ready, workload.Desired,
+		)
+	}
+
+	logger.Info("History:")
+	for _, revision := range status.History {
+		logger.Infof(
+			" - %d | %s | %s | %s | %s | %s",
+			revision.Revision, revision.Updated.Format(timeFormat), revision.Status,
+			revision.Chart, revision.AppVersion, revision.Description,
+		)
+	}
+}
@@ -60,3 +60,64 @@ func (c *cloudfront) Invalidate(path string) error {
 
 	return nil
 }
+
+func (c *cloudfront) SetOriginPath(originID, path string) error {
+	// 1) Get current config
+	out, err := c.client.GetDistributionConfig(&awscloudfront.GetDistributionConfigInput{
+		Id: aws.String(c.distribution),
+	})
+	if err != nil {
+		return fmt.Errorf(
+			"Failed getting config of Cloudfront distribution '%s': %s", c.distribution, err,
+		)
+	}
+
+	// 2) Find origin
+	origins := out.DistributionConfig.Origins.Items
+	var origin *awscloudfront.Origin
+	if originID == "" {
+		if len(origins) != 1 {
+			return fmt.Errorf(
+				"Cloudfront distribution '%s' has %d origins, origin ID must be given",
+				c.distribution, len(origins),
+			)
+		}
+		origin = origins[0]
+	} else {
+		for _, candidate := range origins {
+			if aws.StringValue(candidate.Id) == originID {
+				origin = candidate
+			}
+		}
+		if origin == nil {
+			return fmt.Errorf(
+				"Cloudfront distribution '%s' has no origin '%s'", c.distribution, originID,
+			)
+		}
+	}
+
+	// 3) Update origin path (the ETag prevents overwriting concurrent changes)
+	origin.OriginPath = aws.String(path)
+	_, err = c.client.UpdateDistribution(&awscloudfront.UpdateDistributionInput{
+		Id:                 aws.String(c.distribution),
+		IfMatch:            out.ETag,
+		DistributionConfig: out.DistributionConfig,
+	})
+	if err != nil {
+		return fmt.Errorf(
+			"Failed updating Cloudfront distribution '%s': %s", c.distribution, err,
+		)
+	}
+
+	// 4) Wait until the change has propagated to all edge locations
+	err = c.client.WaitUntilDistributionDeployed(&awscloudfront.GetDistributionInput{
+		Id: aws.String(c.distribution),
+	})
+	if err != nil {
+		return fmt.Errorf(
+			"Failed waiting for Cloudfront distribution '%s' to deploy: %s", c.distribution, err,
+		)
+	}
+
+	return nil
+}
@@ -5,4 +5,9 @@ type Provider interface {
 
 	// Invalidate invalidates the given cache path and returns an error upon failure.
 	Invalidate(path string) error
+
+	// SetOriginPath sets the path from which the origin with the given ID serves content. If no ID
+	// is given, the CDN must have a single origin. It returns once the change has been deployed
+	// and returns an error upon failure.
+	SetOriginPath(originID, path string) error
 }
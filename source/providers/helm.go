@@ -1,9 +1,13 @@
 package providers
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
@@ -17,6 +21,7 @@ import (
 	"helm.sh/helm/v3/pkg/cli/values"
 	"helm.sh/helm/v3/pkg/downloader"
 	"helm.sh/helm/v3/pkg/getter"
+	"helm.sh/helm/v3/pkg/registry"
 	"helm.sh/helm/v3/pkg/storage/driver"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp" // enable gcp auth providers
 )
@@ -34,6 +39,20 @@ type HelmRelease struct {
 	logger     typewriter.CLILogger
 }
 
+// HelmUpgradeOptions configures how Helm installs or upgrades a release.
+type HelmUpgradeOptions struct {
+	Timeout         time.Duration
+	Atomic          bool
+	Wait            bool
+	WaitForJobs     bool
+	MaxHistory      int
+	Force           bool
+	ResetValues     bool
+	ReuseValues     bool
+	CreateNamespace bool
+	DryRun          bool
+}
+
 type helmChart struct {
 	APIVersion   string        `yaml:"apiVersion"`
 	Type         string        `yaml:"type"`
@@ -43,9 +62,52 @@ type helmChart struct {
 	Dependencies []interface{} `yaml:"dependencies"`
 }
 
+// HelmValues describes the values used for a release along with the data that is made available
+// when templating values files. Values set explicitly take precedence over values files, the
+// precedence among them is: JSONValues < EnvPrefix < Values < StringValues < FileValues. Secret
+// files are Sops-encrypted values files which are decrypted in memory and take precedence over
+// regular values files. Secrets are added to the release's manifests.
+type HelmValues struct {
+	Files        []string
+	SecretFiles  []string
+	Secrets      []HelmSecret
+	Values       []string
+	StringValues []string
+	FileValues   []string
+	JSONValues   []string
+	EnvPrefix    string
+	Image        string
+	Tag          string
+	Commit       HelmCommit
+}
+
+// HelmCommit describes the commit from which a release is deployed.
+type HelmCommit struct {
+	Hash       string
+	Tag        string
+	Branch     string
+	BranchSlug string
+}
+
 type templateValues struct {
 	Name      string
 	Namespace string
+	Image     string
+	Tag       string
+	Commit    templateCommit
+	Branch    templateBranch
+	Env       map[string]string
+}
+
+type templateCommit struct {
+	Hash      string
+	ShortHash string
+	Tag       string
+}
+
+type templateBranch struct {
+	Name string
+	Slug string
 }
 
 // NewHelmRelease initializes a new Helm release and sets its properties correctly.
@@ -59,13 +121,19 @@ func NewHelmRelease(
 	err := config.Init(
 		settings.RESTClientGetter(), namespace, "secrets",
 		func(format string, values ...interface{}) {
-			fmt.Printf(fmt.Sprintf("%s\n", format), values...)
+			fmt.Fprintf(os.Stderr, fmt.Sprintf("%s\n", format), values...)
 		},
 	)
 	if err != nil {
 		return nil, err
 	}
 
+	registryClient, err := newRegistryClient()
+	if err != nil {
+		return nil, err
+	}
+	config.RegistryClient = registryClient
+
 	return &HelmRelease{
 		repo:      repo,
 		name:      name,
@@ -78,10 +146,16 @@ func NewHelmRelease(
 	}, nil
 }
 
+// IsRemoteChart returns whether the release refers to a chart from a Helm repository or an OCI
+// registry.
+func (release *HelmRelease) IsRemoteChart() bool {
+	return release.repo != "" || registry.IsOCI(release.chart)
+}
+
 // IsLocalChart returns whether the release refers to a proper local chart (including a templates
 // directory).
 func (release *HelmRelease) IsLocalChart() bool {
-	if release.repo != "" {
+	if release.IsRemoteChart() {
 		return false
 	}
 	templatesDir := fmt.Sprintf("%s/templates", release.chart)
@@ -90,23 +164,28 @@ func (release *HelmRelease) IsLocalChart() bool {
 }
 
 // Upgrade runs the helm upgrade command for the release (and optionally installs).
-func (release *HelmRelease) Upgrade(valuesFiles []string, image, tag string, dryRun bool) error {
+func (release *HelmRelease) Upgrade(values HelmValues, options HelmUpgradeOptions) error {
 	// 1) Get Helm chart
 	var chart *chart.Chart
-	var values map[string]interface{}
+	var chartValues map[string]interface{}
 	var err error
 
-	if release.repo != "" {
-		chart, values, err = release.getRemoteChart(valuesFiles)
+	if release.IsRemoteChart() {
+		chart, chartValues, err = release.getRemoteChart(values)
 	} else if release.IsLocalChart() {
-		chart, values, err = release.getLocalChart(valuesFiles, image, tag)
+		chart, chartValues, err = release.getLocalChart(values)
 	} else {
-		chart, values, err = release.getLocalDir()
+		chart, chartValues, err = release.getLocalDir()
 	}
 	if err != nil {
 		return err
 	}
 
+	postRenderer, err := release.secretsRenderer(values.Secrets)
+	if err != nil {
+		return err
+	}
+
 	// 2) Check if release already exists, install if not
 	history := action.NewHistory(release.config)
 	history.Max = 1
@@ -115,16 +194,19 @@ func (release *HelmRelease) Upgrade(valuesFiles []string, image, tag string, dry
 		release.logger.Infof("Installing %s...", release.name)
 
 		install := action.NewInstall(release.config)
-		install.DryRun = dryRun
+		install.DryRun = options.DryRun
 		install.DisableHooks = false
-		install.Timeout = 15 * time.Minute
-		install.Wait = true
-		install.Atomic = true
+		install.Timeout = options.Timeout
+		install.Wait = options.Wait
+		install.WaitForJobs = options.WaitForJobs
+		install.Atomic = options.Atomic
+		install.CreateNamespace = options.CreateNamespace
 		install.ReleaseName = release.name
 		install.Namespace = release.namespace
 		install.Version = release.version
+		install.PostRenderer = postRenderer
 
-		_, err := install.Run(chart, values)
+		_, err := install.Run(chart, chartValues)
 		if err != nil {
 			return fmt.Errorf("Unable to freshly install release: %s", err)
 		}
@@ -135,24 +217,92 @@ func (release *HelmRelease) Upgrade(valuesFiles []string, image, tag string, dry
 	release.logger.Infof("Upgrading %s...", release.name)
 
 	upgrade := action.NewUpgrade(release.config)
-	upgrade.DryRun = dryRun
+	upgrade.DryRun = options.DryRun
 	upgrade.DisableHooks = false
-	upgrade.Timeout = 15 * time.Minute
-	upgrade.Wait = true
-	upgrade.Atomic = true
-	upgrade.MaxHistory = 10
+	upgrade.Timeout = options.Timeout
+	upgrade.Wait = options.Wait
+	upgrade.WaitForJobs = options.WaitForJobs
+	upgrade.Atomic = options.Atomic
+	upgrade.Force = options.Force
+	upgrade.ResetValues = options.ResetValues
+	upgrade.ReuseValues = options.ReuseValues
+	upgrade.MaxHistory = options.MaxHistory
 	upgrade.Namespace = release.namespace
 	upgrade.Version = release.version
+	upgrade.PostRenderer = postRenderer
 
-	_, err = upgrade.Run(release.name, chart, values)
+	_, err = upgrade.Run(release.name, chart, chartValues)
 	if err != nil {
 		return fmt.Errorf("Unable to upgrade release: %s", err)
 	}
 	return nil
 }
 
+// Rollback rolls the release back to the given revision. If the revision is 0, the release is
+// rolled back to the previous revision.
+func (release *HelmRelease) Rollback(revision int, options HelmUpgradeOptions) error {
+	release.logger.Infof("Rolling back %s...", release.name)
+
+	rollback := action.NewRollback(release.config)
+	rollback.Version = revision
+	rollback.DryRun = options.DryRun
+	rollback.Timeout = options.Timeout
+	rollback.Wait = options.Wait
+	rollback.WaitForJobs = options.WaitForJobs
+	rollback.Force = options.Force
+	rollback.MaxHistory = options.MaxHistory
+
+	if err := rollback.Run(release.name); err != nil {
+		return fmt.Errorf("Unable to roll back release: %s", err)
+	}
+	return nil
+}
+
+// Revert undoes the latest deployment of the release: it is rolled back to the previous revision
+// or, if the latest revision was the initial installation, uninstalled.
+func (release *HelmRelease) Revert(options HelmUpgradeOptions) error {
+	revisions, err := release.config.Releases.History(release.name)
+	if err != nil {
+		return fmt.Errorf("Unable to get history of release: %s", err)
+	}
+	if len(revisions) <= 1 {
+		return release.Uninstall(options)
+	}
+	return release.Rollback(0, options)
+}
+
+// Uninstall removes the release from the cluster. It does not fail if the release does not exist.
+func (release *HelmRelease) Uninstall(options HelmUpgradeOptions) error {
+	release.logger.Infof("Uninstalling %s...", release.name)
+
+	uninstall := action.NewUninstall(release.config)
+	uninstall.DryRun = options.DryRun
+	uninstall.Timeout = options.Timeout
+
+	_, err := uninstall.Run(release.name)
+	if err != nil && !errors.Is(err, driver.ErrReleaseNotFound) {
+		return fmt.Errorf("Unable to uninstall release: %s", err)
+	}
+	return nil
+}
+
+// Test runs the test hooks of the release and fails if any of them fails. Releases without test
+// hooks pass trivially.
+func (release *HelmRelease) Test(timeout time.Duration) error {
+	release.logger.Infof("Testing %s...", release.name)
+
+	test := action.NewReleaseTesting(release.config)
+	test.Namespace = release.namespace
+	test.Timeout = timeout
+
+	if _, err := test.Run(release.name); err != nil {
+		return fmt.Errorf("Release tests failed: %s", err)
+	}
+	return nil
+}
+
 func (release *HelmRelease) getRemoteChart(
-	valuesFiles []string,
+	values HelmValues,
 ) (*chart.Chart, map[string]interface{}, error) {
 	// 1) Get (remote) location of chart
 	chartPath, err := release.locateChart(release.chart)
@@ -166,83 +316,89 @@ func (release *HelmRelease) getRemoteChart(
 		return nil, nil, err
 	}
 
-	// 3) Read values file
-	valueOpts, err := release.readTemplatedValuesFiles(valuesFiles)
-	if err != nil {
-		return nil, nil, err
-	}
-
-	// 4) Get values
-	values, err := release.getValuesFromOptions(valueOpts)
+	// 3) Get values
+	chartValues, err := release.getValues(values, nil)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	return chart, values, nil
+	return chart, chartValues, nil
 }
 
 func (release *HelmRelease) getLocalChart(
-	valuesFiles []string, image, tag string,
+	values HelmValues,
 ) (*chart.Chart, map[string]interface{}, error) {
-	// 1) Create Chart.yaml
-	err := release.writeChartYaml(release.chart, tag)
+	// 1) Load chart
+	chart, err := release.loadLocalChart(values)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	// 2) Get location of chart
-	chartPath, err := release.locateChart(release.chart)
+	// 2) Get values, setting values for image and tag
+	injected := []string{
+		fmt.Sprintf("image.name=%s", values.Image),
+		fmt.Sprintf("image.tag=%s", values.Tag),
+	}
+	chartValues, err := release.getValues(values, injected)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	// 3) Populate default values.yaml
-	err = release.populateDefaultValuesTemplate()
+	return chart, chartValues, nil
+}
+
+// loadLocalChart loads a local chart after generating its Chart.yaml, templating its default
+// values.yaml and downloading its dependencies. No files of the chart directory are modified.
+func (release *HelmRelease) loadLocalChart(values HelmValues) (*chart.Chart, error) {
+	// 1) Copy chart to temporary directory to not modify any user files
+	chartDir, err := ioutil.TempDir("", "cuckoo-chart-*")
 	if err != nil {
-		return nil, nil, err
+		return nil, fmt.Errorf("Cannot generate temporary directory to store chart: %s", err)
 	}
+	defer os.RemoveAll(chartDir)
 
-	// 4) Load chart
-	chart, err := release.loadChart(chartPath)
-	if err != nil {
-		return nil, nil, err
+	if err := utils.CopyDir(release.chart, chartDir); err != nil {
+		return nil, fmt.Errorf("Cannot copy chart to temporary directory: %s", err)
 	}
 
-	// 5) Update dependencies
-	chart, err = release.downloadDependencies(chart, chartPath)
+	// 2) Create Chart.yaml
+	err = release.writeChartYaml(chartDir, values.Tag)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
-	// 6) Read values
-	valueOpts, err := release.readTemplatedValuesFiles(valuesFiles)
+	// 3) Get location of chart
+	chartPath, err := release.locateChart(chartDir)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
-	// 7) Set values for image and tag
-	valueOpts.Values = []string{
-		fmt.Sprintf("image.name=%s", image),
-		fmt.Sprintf("image.tag=%s", tag),
+	// 4) Populate default values.yaml
+	err = release.populateDefaultValuesTemplate(chartDir, values)
+	if err != nil {
+		return nil, err
 	}
 
-	// 8) Get values
-	values, err := release.getValuesFromOptions(valueOpts)
+	// 5) Load chart
+	chart, err := release.loadChart(chartPath)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
-	return chart, values, nil
+	// 6) Update dependencies
+	return release.downloadDependencies(chart, chartPath)
 }
 
 func (release *HelmRelease) getLocalDir() (*chart.Chart, map[string]interface{}, error) {
-	chartDir := fmt.Sprintf("%s/cuckoo-deploy", os.TempDir())
-	templateDir := fmt.Sprintf("%s/templates", chartDir)
+	chartDir, err := ioutil.TempDir("", "cuckoo-deploy-*")
+	if err != nil {
+		return nil, nil, fmt.Errorf("Cannot generate temporary directory to store chart: %s", err)
+	}
 	defer os.RemoveAll(chartDir)
+	templateDir := filepath.Join(chartDir, "templates")
 
-	// 1) Link all files to templates directory
-	err := os.MkdirAll(templateDir, 0755)
-	if err != nil {
+	// 1) Copy all files to templates directory
+	if err := os.MkdirAll(templateDir, 0755); err != nil {
 		return nil, nil, fmt.Errorf("Cannot generate temporary directory to store chart: %s", err)
 	}
 
@@ -252,25 +408,19 @@ func (release *HelmRelease) getLocalDir() (*chart.Chart, map[string]interface{},
 		return nil, nil, fmt.Errorf("Cannot determine whether chart is file or directory: %s", err)
 	}
 
-	// 1.2) Link file(s)
+	// 1.2) Copy file(s)
+	files := []string{release.chart}
 	if chartInfo.IsDir() {
-		files, err := utils.GetMatchingFiles(".*", release.chart)
+		files, err = utils.GetMatchingFiles(".*", release.chart)
 		if err != nil {
-			return nil, nil, fmt.Errorf("Cannot link to files in chart directory: %s", err)
+			return nil, nil, fmt.Errorf("Cannot find files in chart directory: %s", err)
 		}
+	}
 
-		for _, file := range files {
-			target := fmt.Sprintf("%s/%s", templateDir, strings.ReplaceAll(file, "/", "-"))
-			err := os.Link(file, target)
-			if err != nil {
-				return nil, nil, fmt.Errorf("Cannot link to file '%s': %s", file, err)
-			}
-		}
-	} else {
-		target := fmt.Sprintf("%s/%s", templateDir, strings.ReplaceAll(release.chart, "/", "-"))
-		err := os.Link(release.chart, target)
-		if err != nil {
-			return nil, nil, fmt.Errorf("Cannot link to chart file '%s': %s", release.chart, err)
+	for _, file := range files {
+		target := filepath.Join(templateDir, strings.ReplaceAll(file, "/", "-"))
+		if err := utils.CopyFile(file, target); err != nil {
+			return nil, nil, fmt.Errorf("Cannot copy file '%s': %s", file, err)
 		}
 	}
 
@@ -329,6 +479,10 @@ func (release *HelmRelease) writeChartYaml(chartDir, appVersion string) error {
 }
 
 func (release *HelmRelease) locateChart(location string) (string, error) {
+	if registry.IsOCI(location) {
+		return release.pullRegistryChart(location)
+	}
+
 	pathOptions := action.ChartPathOptions{
 		Version: release.version,
 		RepoURL: release.repo,
@@ -342,13 +496,15 @@ func (release *HelmRelease) locateChart(location string) (string, error) {
 	return chartPath, nil
 }
 
-func (release *HelmRelease) populateDefaultValuesTemplate() error {
-	defaultValuesFile := fmt.Sprintf("%s/values.yaml", release.chart)
+func (release *HelmRelease) populateDefaultValuesTemplate(
+	chartDir string, values HelmValues,
+) error {
+	defaultValuesFile := fmt.Sprintf("%s/values.yaml", chartDir)
 	if _, err := os.Stat(defaultValuesFile); os.IsNotExist(err) {
 		return nil
 	}
 
-	valueTemplate := templateValues{release.name, release.namespace}
+	valueTemplate := release.templateValues(values)
 	err := utils.PopulateTemplateWrite(defaultValuesFile, defaultValuesFile, valueTemplate)
 	if err != nil {
 		return fmt.Errorf("Cannot replace template values in default values.yaml: %s", err)
@@ -391,19 +547,122 @@ func (release *HelmRelease) downloadDependencies(
 	return chart, nil
 }
 
-func (release *HelmRelease) readTemplatedValuesFiles(files []string) (*values.Options, error) {
+// getValues reads all values for the release. Injected values override values files but are
+// overridden by any values set explicitly (including JSON values).
+func (release *HelmRelease) getValues(
+	helmValues HelmValues, injected []string,
+) (map[string]interface{}, error) {
+	// 1) Read values files
+	valueOpts, cleanup, err := release.readTemplatedValuesFiles(helmValues)
+	defer cleanup()
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := release.getValuesFromOptions(valueOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	// 2) Merge decrypted values
+	secretValues, err := decryptValues(helmValues.SecretFiles)
+	if err != nil {
+		return nil, err
+	}
+	result = mergeValues(result, secretValues)
+
+	// 3) Merge injected values
+	injectedValues, err := release.getValuesFromOptions(&values.Options{Values: injected})
+	if err != nil {
+		return nil, err
+	}
+	result = mergeValues(result, injectedValues)
+
+	// 4) Merge JSON values
+	for _, value := range helmValues.JSONValues {
+		jsonValues, err := parseJSONValue(value)
+		if err != nil {
+			return nil, err
+		}
+		result = mergeValues(result, jsonValues)
+	}
+
+	// 5) Merge values set explicitly
+	setValues := []string{}
+	setValues = append(setValues, envValues(helmValues.EnvPrefix)...)
+	setValues = append(setValues, helmValues.Values...)
+
+	overrideOpts := &values.Options{
+		Values:       setValues,
+		StringValues: helmValues.StringValues,
+		FileValues:   helmValues.FileValues,
+	}
+	overrides, err := release.getValuesFromOptions(overrideOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	return mergeValues(result, overrides), nil
+}
+
+// readTemplatedValuesFiles renders all values files into a temporary directory and returns the
+// options referencing the rendered files. The returned function removes the temporary directory.
+func (release *HelmRelease) readTemplatedValuesFiles(
+	helmValues HelmValues,
+) (*values.Options, func(), error) {
 	valueOpts := &values.Options{ValueFiles: []string{}}
+	if len(helmValues.Files) == 0 {
+		return valueOpts, func() {}, nil
+	}
 
-	for _, file := range files {
-		valueTemplate := templateValues{release.name, release.namespace}
-		err := utils.PopulateTemplateWrite(file, file, valueTemplate)
+	// 1) Create directory for rendered files
+	dir, err := ioutil.TempDir("", "cuckoo-values-*")
+	if err != nil {
+		return nil, func() {}, fmt.Errorf("Cannot create temporary directory for values: %s", err)
+	}
+	cleanup := func() {
+		os.RemoveAll(dir)
+	}
+
+	// 2) Render files
+	valueTemplate := release.templateValues(helmValues)
+	for i, file := range helmValues.Files {
+		target := fmt.Sprintf("%s/%d-%s", dir, i, filepath.Base(file))
+		err := utils.PopulateTemplateWrite(file, target, valueTemplate)
 		if err != nil {
-			return nil, fmt.Errorf("Cannot read values file: %s", err)
+			return nil, cleanup, fmt.Errorf("Cannot read values file '%s': %s", file, err)
+		}
+		valueOpts.ValueFiles = append(valueOpts.ValueFiles, target)
+	}
+
+	return valueOpts, cleanup, nil
+}
+
+func (release *HelmRelease) templateValues(values HelmValues) templateValues {
+	shortHash := values.Commit.Hash
+	if len(shortHash) > 7 {
+		shortHash = shortHash[:7]
+	}
+
+	env := make(map[string]string)
+	for _, item := range os.Environ() {
+		splits := strings.SplitN(item, "=", 2)
+		if len(splits) == 2 {
+			env[splits[0]] = splits[1]
 		}
-		valueOpts.ValueFiles = append(valueOpts.ValueFiles, file)
 	}
 
-	return valueOpts, nil
+	return templateValues{
+		Name:      release.name,
+		Namespace: release.namespace,
+		Image:     values.Image,
+		Tag:       values.Tag,
+		Commit: templateCommit{
+			Hash: values.Commit.Hash, ShortHash: shortHash, Tag: values.Commit.Tag,
+		},
+		Branch: templateBranch{Name: values.Commit.Branch, Slug: values.Commit.BranchSlug},
+		Env:    env,
+	}
 }
 
 func (release *HelmRelease) getValuesFromOptions(
@@ -415,3 +674,67 @@ func (release *HelmRelease) getValuesFromOptions(
 	}
 	return values, nil
 }
+
+// mergeValues recursively merges the override values into the base values and returns the result.
+func mergeValues(base, override map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(base))
+	for key, value := range base {
+		result[key] = value
+	}
+
+	for key, value := range override {
+		if valueMap, ok := value.(map[string]interface{}); ok {
+			if baseMap, ok := result[key].(map[string]interface{}); ok {
+				result[key] = mergeValues(baseMap, valueMap)
+				continue
+			}
+		}
+		result[key] = value
+	}
+	return result
+}
+
+// parseJSONValue parses a value of the form <path>=<json> where path is a dot-separated list of
+// keys.
+func parseJSONValue(value string) (map[string]interface{}, error) {
+	splits := strings.SplitN(value, "=", 2)
+	if len(splits) != 2 || splits[0] == "" {
+		return nil, fmt.Errorf("JSON value '%s' has a wrong format", value)
+	}
+
+	var parsed interface{}
+	if err := json.Unmarshal([]byte(splits[1]), &parsed); err != nil {
+		return nil, fmt.Errorf("Cannot parse JSON value for key '%s': %s", splits[0], err)
+	}
+
+	keys := strings.Split(splits[0], ".")
+	for i := len(keys) - 1; i >= 0; i-- {
+		parsed = map[string]interface{}{keys[i]: parsed}
+	}
+	return parsed.(map[string]interface{}), nil
+}
+
+// envValues returns values of the form <path>=<value> for all environment variables with the given
+// prefix. Underscores in the remainder of the variable name separate keys of the path.
+func envValues(prefix string) []string {
+	result := []string{}
+	if prefix == "" {
+		return result
+	}
+
+	for _, item := range os.Environ() {
+		splits := strings.SplitN(item, "=", 2)
+		if len(splits) != 2 || !strings.HasPrefix(splits[0], prefix) {
+			continue
+		}
+
+		path := strings.ReplaceAll(strings.TrimPrefix(splits[0], prefix), "_", ".")
+		if path == "" {
+			continue
+		}
+		value := strings.ReplaceAll(splits[1], ",", "\\,")
+		result = append(result, fmt.Sprintf("%s=%s", path, value))
+	}
+	sort.Strings(result)
+	return result
+}
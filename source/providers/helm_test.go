@@ -0,0 +1,166 @@
+package providers
+
+import (
+	"io/ioutil"
+	"os"
+	"sort"
+	"testing"
+
+	"go.borchero.com/typewriter"
+	"gotest.tools/assert"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/cli"
+	kubefake "helm.sh/helm/v3/pkg/kube/fake"
+	helmrelease "helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+)
+
+func TestMergeValues(t *testing.T) {
+	base := map[string]interface{}{
+		"image":    map[string]interface{}{"name": "nginx", "tag": "1.0.0"},
+		"replicas": 1,
+	}
+	override := map[string]interface{}{
+		"image": map[string]interface{}{"tag": "1.1.0"},
+	}
+
+	merged := mergeValues(base, override)
+	image := merged["image"].(map[string]interface{})
+	assert.Equal(t, image["name"], "nginx", "Merging drops nested values of base.")
+	assert.Equal(t, image["tag"], "1.1.0", "Merging does not override nested values.")
+	assert.Equal(t, merged["replicas"], 1, "Merging drops top-level values of base.")
+}
+
+func TestParseJSONValue(t *testing.T) {
+	parsed, err := parseJSONValue(`ingress.hosts=["a.com","b.com"]`)
+	assert.NilError(t, err)
+
+	ingress := parsed["ingress"].(map[string]interface{})
+	hosts := ingress["hosts"].([]interface{})
+	assert.Equal(t, len(hosts), 2, "JSON list is not parsed correctly.")
+	assert.Equal(t, hosts[1], "b.com", "JSON list is not parsed correctly.")
+
+	_, err = parseJSONValue("ingress.hosts")
+	assert.ErrorContains(t, err, "wrong format")
+}
+
+func TestEnvValues(t *testing.T) {
+	os.Setenv("CUCKOO_TEST_VALUE_foo_bar", "1,2")
+	defer os.Unsetenv("CUCKOO_TEST_VALUE_foo_bar")
+
+	values := envValues("CUCKOO_TEST_VALUE_")
+	assert.DeepEqual(t, values, []string{"foo.bar=1\\,2"})
+	assert.Equal(t, len(envValues("")), 0, "Empty prefix must not yield values.")
+}
+
+func TestGetValuesPrecedence(t *testing.T) {
+	release := &HelmRelease{settings: cli.New()}
+	injected := []string{"image.name=injected", "image.tag=injected"}
+
+	testCases := []struct {
+		name   string
+		values HelmValues
+		image  map[string]interface{}
+	}{
+		{
+			name:   "Injected",
+			values: HelmValues{},
+			image:  map[string]interface{}{"name": "injected", "tag": "injected"},
+		},
+		{
+			name:   "JSONOverridesInjected",
+			values: HelmValues{JSONValues: []string{`image={"tag":"json"}`}},
+			image:  map[string]interface{}{"name": "injected", "tag": "json"},
+		},
+		{
+			name: "SetOverridesJSON",
+			values: HelmValues{
+				JSONValues: []string{`image={"tag":"json"}`},
+				Values:     []string{"image.tag=set"},
+			},
+			image: map[string]interface{}{"name": "injected", "tag": "set"},
+		},
+		{
+			name: "SetStringOverridesSet",
+			values: HelmValues{
+				Values:       []string{"image.name=set"},
+				StringValues: []string{"image.name=string"},
+			},
+			image: map[string]interface{}{"name": "string", "tag": "injected"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			values, err := release.getValues(testCase.values, injected)
+			assert.NilError(t, err)
+			assert.DeepEqual(t, values["image"], testCase.image)
+		})
+	}
+}
+
+func TestHelmReleaseRevert(t *testing.T) {
+	testCases := []struct {
+		name     string
+		statuses []helmrelease.Status
+		versions []int
+	}{
+		{
+			name:     "FirstInstallation",
+			statuses: []helmrelease.Status{helmrelease.StatusDeployed},
+		},
+		{
+			name: "Upgrade",
+			statuses: []helmrelease.Status{
+				helmrelease.StatusSuperseded, helmrelease.StatusDeployed,
+			},
+			versions: []int{1, 2, 3},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			config := &action.Configuration{
+				Releases:     storage.Init(driver.NewMemory()),
+				KubeClient:   &kubefake.PrintingKubeClient{Out: ioutil.Discard},
+				Capabilities: chartutil.DefaultCapabilities,
+				Log:          func(format string, values ...interface{}) {},
+			}
+			for i, status := range testCase.statuses {
+				revision := helmrelease.Mock(&helmrelease.MockReleaseOptions{
+					Name: "app", Namespace: "default", Version: i + 1, Status: status,
+				})
+				assert.NilError(t, config.Releases.Create(revision))
+			}
+
+			release := &HelmRelease{
+				name:      "app",
+				namespace: "default",
+				config:    config,
+				logger:    typewriter.NewCLILogger(),
+			}
+			assert.NilError(t, release.Revert(HelmUpgradeOptions{}))
+
+			// The initial installation is uninstalled, upgrades are rolled back
+			revisions, err := config.Releases.History("app")
+			if testCase.versions == nil {
+				assert.Equal(t, len(revisions), 0)
+				return
+			}
+			assert.NilError(t, err)
+			versions := make([]int, len(revisions))
+			for i, revision := range revisions {
+				versions[i] = revision.Version
+			}
+			sort.Ints(versions)
+			assert.DeepEqual(t, versions, testCase.versions)
+
+			last, err := config.Releases.Last("app")
+			assert.NilError(t, err)
+			assert.Equal(t, last.Info.Status, helmrelease.StatusDeployed)
+			assert.Equal(t, last.Info.Description, "Rollback to 1")
+		})
+	}
+}
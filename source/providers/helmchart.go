@@ -0,0 +1,162 @@
+package providers
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/downloader"
+	"helm.sh/helm/v3/pkg/getter"
+	"helm.sh/helm/v3/pkg/provenance"
+	"helm.sh/helm/v3/pkg/registry"
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+// Package packages the local chart of the release (including its generated Chart.yaml and all
+// dependencies) into a .tgz archive within the given directory and returns the archive's path.
+func (release *HelmRelease) Package(values HelmValues, destination string) (string, error) {
+	// 1) Load chart
+	chart, err := release.loadLocalChart(values)
+	if err != nil {
+		return "", err
+	}
+
+	// 2) Save archive
+	if err := os.MkdirAll(destination, 0755); err != nil {
+		return "", fmt.Errorf("Cannot create destination directory: %s", err)
+	}
+
+	path, err := chartutil.Save(chart, destination)
+	if err != nil {
+		return "", fmt.Errorf("Unable to package chart: %s", err)
+	}
+	return path, nil
+}
+
+// Push packages the local chart of the release and pushes it to the OCI registry at the given
+// location (oci://<host>/<path>). It returns the reference of the pushed chart.
+func (release *HelmRelease) Push(values HelmValues, remote string) (string, error) {
+	if !registry.IsOCI(remote) {
+		return "", fmt.Errorf("Remote '%s' is not an OCI reference (oci://...)", remote)
+	}
+
+	// 1) Package chart
+	dir, err := ioutil.TempDir("", "cuckoo-package-*")
+	if err != nil {
+		return "", fmt.Errorf("Cannot create temporary directory for package: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path, err := release.Package(values, dir)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("Cannot read packaged chart: %s", err)
+	}
+
+	// 2) Push to registry
+	ref := fmt.Sprintf(
+		"%s/%s:%s",
+		strings.TrimSuffix(strings.TrimPrefix(remote, "oci://"), "/"),
+		release.name, release.version,
+	)
+	release.logger.Infof("Pushing chart to %s...", ref)
+
+	if _, err := release.config.RegistryClient.Push(data, ref); err != nil {
+		return "", fmt.Errorf("Unable to push chart to registry: %s", err)
+	}
+	return ref, nil
+}
+
+// AddToHelmIndex adds the packaged chart at the given path to the Helm repository index file. The
+// index file is created if it does not exist. The chart is expected to be served at the given base
+// URL, the URL is relative to the index file if the base URL is empty.
+func AddToHelmIndex(indexFile, chartPath, baseURL string) error {
+	// 1) Load existing index
+	index := repo.NewIndexFile()
+	if _, err := os.Stat(indexFile); err == nil {
+		index, err = repo.LoadIndexFile(indexFile)
+		if err != nil {
+			return fmt.Errorf("Unable to load repository index: %s", err)
+		}
+	}
+
+	// 2) Add chart
+	chart, err := loader.LoadFile(chartPath)
+	if err != nil {
+		return fmt.Errorf("Unable to load packaged chart: %s", err)
+	}
+	if index.Has(chart.Metadata.Name, chart.Metadata.Version) {
+		return fmt.Errorf(
+			"Chart '%s' with version '%s' already exists in repository",
+			chart.Metadata.Name, chart.Metadata.Version,
+		)
+	}
+
+	digest, err := provenance.DigestFile(chartPath)
+	if err != nil {
+		return fmt.Errorf("Unable to compute digest of packaged chart: %s", err)
+	}
+
+	err = index.MustAdd(chart.Metadata, filepath.Base(chartPath), baseURL, digest)
+	if err != nil {
+		return fmt.Errorf("Unable to add chart to repository index: %s", err)
+	}
+	index.SortEntries()
+
+	// 3) Write index
+	if err := index.WriteFile(indexFile, 0644); err != nil {
+		return fmt.Errorf("Unable to write repository index: %s", err)
+	}
+	return nil
+}
+
+func (release *HelmRelease) pullRegistryChart(location string) (string, error) {
+	// 1) Ensure that cache directory exists
+	cache := release.settings.RepositoryCache
+	if err := os.MkdirAll(cache, 0755); err != nil {
+		return "", fmt.Errorf("Cannot create repository cache: %s", err)
+	}
+
+	// 2) Download chart
+	chartDownloader := downloader.ChartDownloader{
+		Out:              os.Stderr,
+		Getters:          getter.All(release.settings),
+		Options:          []getter.Option{getter.WithRegistryClient(release.config.RegistryClient)},
+		RegistryClient:   release.config.RegistryClient,
+		RepositoryConfig: release.settings.RepositoryConfig,
+		RepositoryCache:  cache,
+	}
+
+	chartPath, _, err := chartDownloader.DownloadTo(location, release.version, cache)
+	if err != nil {
+		return "", fmt.Errorf("Unable to pull chart from registry: %s", err)
+	}
+	return chartPath, nil
+}
+
+// newRegistryClient returns a client for OCI registries which uses the credentials from the Docker
+// config (as written by 'cuckoo auth').
+func newRegistryClient() (*registry.Client, error) {
+	usr, err := user.Current()
+	if err != nil {
+		return nil, fmt.Errorf("Cannot get home directory: %s", err)
+	}
+
+	client, err := registry.NewClient(
+		registry.ClientOptCredentialsFile(filepath.Join(usr.HomeDir, ".docker", "config.json")),
+		registry.ClientOptWriter(os.Stderr),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to initialize registry client: %s", err)
+	}
+	return client, nil
+}
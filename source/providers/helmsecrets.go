@@ -0,0 +1,146 @@
+package providers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/postrender"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// HelmSecret describes a Kubernetes secret which is generated from a Sops-encrypted file when
+// deploying a release. Dotenv, YAML and JSON files yield one key per (top-level) entry, all other
+// files yield a single key named after the file.
+type HelmSecret struct {
+	Name string
+	File string
+}
+
+// ParseHelmSecret parses a secret from its textual representation '<name>=<file>'.
+func ParseHelmSecret(spec string) (HelmSecret, error) {
+	parts := strings.SplitN(spec, "=", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return HelmSecret{}, fmt.Errorf("Secret '%s' has wrong format (<name>=<file>)", spec)
+	}
+	return HelmSecret{Name: parts[0], File: parts[1]}, nil
+}
+
+// secretsPostRenderer appends secret manifests to the manifests rendered by Helm. This way,
+// secrets are part of the release without their plaintext being written to disk.
+type secretsPostRenderer struct {
+	manifests []byte
+}
+
+func (renderer *secretsPostRenderer) Run(rendered *bytes.Buffer) (*bytes.Buffer, error) {
+	result := bytes.NewBuffer(rendered.Bytes())
+	result.WriteString("\n")
+	result.Write(renderer.manifests)
+	return result, nil
+}
+
+// secretsRenderer decrypts the given secrets and returns a post renderer which adds them to the
+// release's manifests. It returns nil if no secrets are given.
+func (release *HelmRelease) secretsRenderer(secrets []HelmSecret) (postrender.PostRenderer, error) {
+	if len(secrets) == 0 {
+		return nil, nil
+	}
+
+	sops := NewSops()
+	buf := new(bytes.Buffer)
+	for _, secret := range secrets {
+		// 1) Decrypt file
+		contents, err := sops.Decrypt(secret.File)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to decrypt secret '%s': %s", secret.File, err)
+		}
+
+		data, err := secretData(secret.File, contents)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read secret '%s': %s", secret.File, err)
+		}
+
+		// 2) Generate manifest
+		manifest := corev1.Secret{
+			TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"},
+			ObjectMeta: metav1.ObjectMeta{
+				Name: secret.Name, Namespace: release.namespace,
+			},
+			Type: corev1.SecretTypeOpaque,
+			Data: data,
+		}
+
+		encoded, err := json.Marshal(manifest)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to encode secret '%s': %s", secret.Name, err)
+		}
+		buf.WriteString("---\n")
+		buf.Write(encoded)
+		buf.WriteString("\n")
+	}
+
+	return &secretsPostRenderer{manifests: buf.Bytes()}, nil
+}
+
+// decryptValues decrypts the given values files and merges their values in order.
+func decryptValues(files []string) (map[string]interface{}, error) {
+	sops := NewSops()
+	result := make(map[string]interface{})
+	for _, file := range files {
+		contents, err := sops.Decrypt(file)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to decrypt values file '%s': %s", file, err)
+		}
+
+		values, err := chartutil.ReadValues(contents)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to parse values file '%s': %s", file, err)
+		}
+		result = mergeValues(result, values)
+	}
+	return result, nil
+}
+
+// secretData returns the data of a secret read from the given (decrypted) contents of the given
+// file.
+func secretData(file string, contents []byte) (map[string][]byte, error) {
+	result := make(map[string][]byte)
+
+	switch sopsFormat(file) {
+	case "dotenv":
+		values, err := parseDotenv(contents)
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range values {
+			result[key] = []byte(value)
+		}
+	case "yaml", "json":
+		values, err := chartutil.ReadValues(contents)
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range values {
+			switch value.(type) {
+			case map[string]interface{}, []interface{}:
+				return nil, fmt.Errorf("Value of key '%s' is not a scalar", key)
+			case nil:
+				result[key] = []byte{}
+			case float64:
+				result[key] = []byte(strconv.FormatFloat(value.(float64), 'f', -1, 64))
+			default:
+				result[key] = []byte(fmt.Sprint(value))
+			}
+		}
+	default:
+		name := strings.Replace(filepath.Base(file), ".enc.", ".", 1)
+		result[name] = contents
+	}
+
+	return result, nil
+}
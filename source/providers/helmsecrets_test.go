@@ -0,0 +1,36 @@
+package providers
+
+import (
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestParseHelmSecret(t *testing.T) {
+	secret, err := ParseHelmSecret("database=secrets/database.enc.env")
+	assert.NilError(t, err)
+	assert.Equal(t, secret.Name, "database", "Name is not parsed correctly.")
+	assert.Equal(t, secret.File, "secrets/database.enc.env", "File is not parsed correctly.")
+
+	_, err = ParseHelmSecret("secrets/database.enc.env")
+	assert.ErrorContains(t, err, "wrong format")
+}
+
+func TestSecretData(t *testing.T) {
+	data, err := secretData("db.enc.env", []byte("# comment\nUSER=admin\nPASSWORD=a=b\n"))
+	assert.NilError(t, err)
+	assert.Equal(t, string(data["USER"]), "admin", "Dotenv is not parsed correctly.")
+	assert.Equal(t, string(data["PASSWORD"]), "a=b", "Dotenv is not parsed correctly.")
+
+	data, err = secretData("db.enc.yaml", []byte("user: admin\nport: 5432\n"))
+	assert.NilError(t, err)
+	assert.Equal(t, string(data["user"]), "admin", "YAML is not parsed correctly.")
+	assert.Equal(t, string(data["port"]), "5432", "YAML is not parsed correctly.")
+
+	_, err = secretData("db.enc.yaml", []byte("user:\n  name: admin\n"))
+	assert.ErrorContains(t, err, "not a scalar")
+
+	data, err = secretData("certs/tls.enc.key", []byte("key"))
+	assert.NilError(t, err)
+	assert.Equal(t, string(data["tls.key"]), "key", "Binary file is not read correctly.")
+}
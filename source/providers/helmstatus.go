@@ -0,0 +1,234 @@
+package providers
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"gopkg.in/yaml.v2"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/releaseutil"
+)
+
+// HelmReleaseStatus describes the current state of a deployed Helm release.
+type HelmReleaseStatus struct {
+	Name         string               `json:"name"`
+	Namespace    string               `json:"namespace"`
+	Revision     int                  `json:"revision"`
+	Status       string               `json:"status"`
+	Chart        string               `json:"chart"`
+	ChartVersion string               `json:"chartVersion"`
+	AppVersion   string               `json:"appVersion"`
+	LastDeployed time.Time            `json:"lastDeployed"`
+	Images       []string             `json:"images"`
+	Workloads    []HelmWorkloadStatus `json:"workloads"`
+	History      []HelmRevision       `json:"history"`
+}
+
+// HelmWorkloadStatus describes the pod readiness of a single workload deployed by a release.
+type HelmWorkloadStatus struct {
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	Ready     int32  `json:"ready"`
+	Desired   int32  `json:"desired"`
+	Error     string `json:"error,omitempty"`
+}
+
+// HelmRevision describes a single entry of a release's history.
+type HelmRevision struct {
+	Revision    int       `json:"revision"`
+	Status      string    `json:"status"`
+	Chart       string    `json:"chart"`
+	AppVersion  string    `json:"appVersion"`
+	Updated     time.Time `json:"updated"`
+	Description string    `json:"description"`
+}
+
+type manifestWorkload struct {
+	Kind     string `yaml:"kind"`
+	Metadata struct {
+		Name      string `yaml:"name"`
+		Namespace string `yaml:"namespace"`
+	} `yaml:"metadata"`
+	Spec struct {
+		Template    manifestPodTemplate `yaml:"template"`
+		JobTemplate struct {
+			Spec struct {
+				Template manifestPodTemplate `yaml:"template"`
+			} `yaml:"spec"`
+		} `yaml:"jobTemplate"`
+	} `yaml:"spec"`
+}
+
+type manifestPodTemplate struct {
+	Spec struct {
+		Containers     []manifestContainer `yaml:"containers"`
+		InitContainers []manifestContainer `yaml:"initContainers"`
+	} `yaml:"spec"`
+}
+
+type manifestContainer struct {
+	Image string `yaml:"image"`
+}
+
+// Status returns the current status of the release along with the given number of most recent
+// history entries.
+func (release *HelmRelease) Status(historyMax int) (*HelmReleaseStatus, error) {
+	// 1) Get current release
+	status := action.NewStatus(release.config)
+	current, err := status.Run(release.name)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get status of release: %s", err)
+	}
+
+	result := &HelmReleaseStatus{
+		Name:      current.Name,
+		Namespace: current.Namespace,
+		Revision:  current.Version,
+		Images:    []string{},
+		Workloads: []HelmWorkloadStatus{},
+		History:   []HelmRevision{},
+	}
+	if current.Info != nil {
+		result.Status = current.Info.Status.String()
+		result.LastDeployed = current.Info.LastDeployed.Time
+	}
+	if current.Chart != nil && current.Chart.Metadata != nil {
+		result.Chart = current.Chart.Metadata.Name
+		result.ChartVersion = current.Chart.Metadata.Version
+		result.AppVersion = current.Chart.Metadata.AppVersion
+	}
+
+	// 2) Inspect deployed workloads
+	workloads, err := parseManifestWorkloads(current.Manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	// 2.1) Collect images
+	images := make(map[string]bool)
+	for _, workload := range workloads {
+		for _, image := range workload.images() {
+			images[image] = true
+		}
+	}
+	for image := range images {
+		result.Images = append(result.Images, image)
+	}
+	sort.Strings(result.Images)
+
+	// 2.2) Get pod readiness
+	kube, err := NewKubernetes()
+	if err != nil {
+		return nil, err
+	}
+	for _, workload := range workloads {
+		if !workload.hasReadiness() {
+			continue
+		}
+
+		namespace := workload.Metadata.Namespace
+		if namespace == "" {
+			namespace = release.namespace
+		}
+
+		workloadStatus := HelmWorkloadStatus{
+			Kind: workload.Kind, Name: workload.Metadata.Name, Namespace: namespace,
+		}
+		ready, desired, err := kube.WorkloadReadiness(
+			namespace, workload.Kind, workload.Metadata.Name,
+		)
+		if err != nil {
+			workloadStatus.Error = err.Error()
+		}
+		workloadStatus.Ready = ready
+		workloadStatus.Desired = desired
+		result.Workloads = append(result.Workloads, workloadStatus)
+	}
+
+	// 3) Get history
+	history := action.NewHistory(release.config)
+	revisions, err := history.Run(release.name)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get history of release: %s", err)
+	}
+
+	releaseutil.Reverse(revisions, releaseutil.SortByRevision)
+	if historyMax > 0 && len(revisions) > historyMax {
+		revisions = revisions[:historyMax]
+	}
+	for _, revision := range revisions {
+		result.History = append(result.History, newHelmRevision(revision))
+	}
+
+	return result, nil
+}
+
+func newHelmRevision(revision *release.Release) HelmRevision {
+	result := HelmRevision{Revision: revision.Version}
+	if revision.Info != nil {
+		result.Status = revision.Info.Status.String()
+		result.Updated = revision.Info.LastDeployed.Time
+		result.Description = revision.Info.Description
+	}
+	if revision.Chart != nil && revision.Chart.Metadata != nil {
+		result.Chart = fmt.Sprintf(
+			"%s-%s", revision.Chart.Metadata.Name, revision.Chart.Metadata.Version,
+		)
+		result.AppVersion = revision.Chart.Metadata.AppVersion
+	}
+	return result
+}
+
+func parseManifestWorkloads(manifest string) ([]manifestWorkload, error) {
+	manifests := releaseutil.SplitManifests(manifest)
+
+	// Sort keys to obtain a stable ordering of workloads
+	keys := make([]string, 0, len(manifests))
+	for key := range manifests {
+		keys = append(keys, key)
+	}
+	sort.Sort(releaseutil.BySplitManifestsOrder(keys))
+
+	result := make([]manifestWorkload, 0)
+	for _, key := range keys {
+		var workload manifestWorkload
+		if err := yaml.Unmarshal([]byte(manifests[key]), &workload); err != nil {
+			return nil, fmt.Errorf("Unable to parse release manifest: %s", err)
+		}
+		if workload.Kind == "" {
+			continue
+		}
+		result = append(result, workload)
+	}
+	return result, nil
+}
+
+func (workload manifestWorkload) images() []string {
+	containers := []manifestContainer{}
+	for _, template := range []manifestPodTemplate{
+		workload.Spec.Template, workload.Spec.JobTemplate.Spec.Template,
+	} {
+		containers = append(containers, template.Spec.InitContainers...)
+		containers = append(containers, template.Spec.Containers...)
+	}
+
+	result := make([]string, 0, len(containers))
+	for _, container := range containers {
+		if container.Image != "" {
+			result = append(result, container.Image)
+		}
+	}
+	return result
+}
+
+func (workload manifestWorkload) hasReadiness() bool {
+	switch workload.Kind {
+	case "Deployment", "StatefulSet", "DaemonSet":
+		return true
+	default:
+		return false
+	}
+}
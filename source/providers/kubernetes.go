@@ -0,0 +1,254 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+
+	"helm.sh/helm/v3/pkg/cli"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/restmapper"
+)
+
+// Kubernetes provides access to Kubernetes resources which are not managed via Helm directly.
+type Kubernetes struct {
+	client  kubernetes.Interface
+	dynamic dynamic.Interface
+	mapper  *restmapper.DeferredDiscoveryRESTMapper
+}
+
+// NewKubernetes initializes a new Kubernetes client from the current kubeconfig.
+func NewKubernetes() (*Kubernetes, error) {
+	settings := cli.New()
+	getter := settings.RESTClientGetter()
+
+	config, err := getter.ToRESTConfig()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read kubeconfig: %s", err)
+	}
+
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to initialize Kubernetes client: %s", err)
+	}
+
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to initialize dynamic Kubernetes client: %s", err)
+	}
+
+	discovery, err := getter.ToDiscoveryClient()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to initialize Kubernetes discovery: %s", err)
+	}
+
+	return &Kubernetes{
+		client:  client,
+		dynamic: dynamicClient,
+		mapper:  restmapper.NewDeferredDiscoveryRESTMapper(discovery),
+	}, nil
+}
+
+// WorkloadReadiness returns the number of ready pods as well as the number of desired pods for the
+// workload (deployment, stateful set or daemon set) of the given kind and name.
+func (k *Kubernetes) WorkloadReadiness(namespace, kind, name string) (int32, int32, error) {
+	ctx := context.Background()
+	options := metav1.GetOptions{}
+
+	switch kind {
+	case "Deployment":
+		deployment, err := k.client.AppsV1().Deployments(namespace).Get(ctx, name, options)
+		if err != nil {
+			return 0, 0, fmt.Errorf("Unable to get deployment '%s': %s", name, err)
+		}
+		return deployment.Status.ReadyReplicas, replicasOrDefault(deployment.Spec.Replicas), nil
+	case "StatefulSet":
+		statefulSet, err := k.client.AppsV1().StatefulSets(namespace).Get(ctx, name, options)
+		if err != nil {
+			return 0, 0, fmt.Errorf("Unable to get stateful set '%s': %s", name, err)
+		}
+		return statefulSet.Status.ReadyReplicas, replicasOrDefault(statefulSet.Spec.Replicas), nil
+	case "DaemonSet":
+		daemonSet, err := k.client.AppsV1().DaemonSets(namespace).Get(ctx, name, options)
+		if err != nil {
+			return 0, 0, fmt.Errorf("Unable to get daemon set '%s': %s", name, err)
+		}
+		return daemonSet.Status.NumberReady, daemonSet.Status.DesiredNumberScheduled, nil
+	default:
+		return 0, 0, fmt.Errorf("Workload kind '%s' is not supported", kind)
+	}
+}
+
+// IsNamespaced returns whether resources of the given kind are namespaced.
+func (k *Kubernetes) IsNamespaced(gvk schema.GroupVersionKind) (bool, error) {
+	mapping, err := k.restMapping(gvk)
+	if err != nil {
+		return false, err
+	}
+	return mapping.Scope.Name() == meta.RESTScopeNameNamespace, nil
+}
+
+// Apply applies the given object via server-side apply using the given field manager. Conflicts
+// with other field managers are resolved in favor of the given field manager.
+func (k *Kubernetes) Apply(
+	object *unstructured.Unstructured, fieldManager string, dryRun bool,
+) error {
+	// 1) Get resource
+	resource, err := k.resource(object.GroupVersionKind(), object.GetNamespace())
+	if err != nil {
+		return err
+	}
+
+	// 2) Apply
+	data, err := object.MarshalJSON()
+	if err != nil {
+		return fmt.Errorf("Unable to encode %s '%s': %s", object.GetKind(), object.GetName(), err)
+	}
+
+	force := true
+	options := metav1.PatchOptions{FieldManager: fieldManager, Force: &force}
+	if dryRun {
+		options.DryRun = []string{metav1.DryRunAll}
+	}
+
+	ctx := context.Background()
+	_, err = resource.Patch(ctx, object.GetName(), types.ApplyPatchType, data, options)
+	if err != nil {
+		return fmt.Errorf("Unable to apply %s '%s': %s", object.GetKind(), object.GetName(), err)
+	}
+	return nil
+}
+
+// Get returns the object of the given kind with the given name. The namespace is ignored for
+// resources which are not namespaced.
+func (k *Kubernetes) Get(
+	gvk schema.GroupVersionKind, namespace, name string,
+) (*unstructured.Unstructured, error) {
+	resource, err := k.resource(gvk, namespace)
+	if err != nil {
+		return nil, err
+	}
+	return resource.Get(context.Background(), name, metav1.GetOptions{})
+}
+
+// Delete deletes the object of the given kind with the given name along with its dependents. The
+// namespace is ignored for resources which are not namespaced.
+func (k *Kubernetes) Delete(gvk schema.GroupVersionKind, namespace, name string) error {
+	resource, err := k.resource(gvk, namespace)
+	if err != nil {
+		return err
+	}
+
+	propagation := metav1.DeletePropagationBackground
+	options := metav1.DeleteOptions{PropagationPolicy: &propagation}
+	if err := resource.Delete(context.Background(), name, options); err != nil {
+		return fmt.Errorf("Unable to delete %s '%s': %s", gvk.Kind, name, err)
+	}
+	return nil
+}
+
+// EnsureNamespace creates the namespace with the given name if it does not exist yet. The given
+// labels and annotations are added to the namespace in any case.
+func (k *Kubernetes) EnsureNamespace(name string, labels, annotations map[string]string) error {
+	ctx := context.Background()
+	namespaces := k.client.CoreV1().Namespaces()
+
+	// 1) Create namespace if it does not exist
+	namespace, err := namespaces.Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		namespace = &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: name, Labels: labels, Annotations: annotations,
+			},
+		}
+		if _, err := namespaces.Create(ctx, namespace, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("Unable to create namespace '%s': %s", name, err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Unable to get namespace '%s': %s", name, err)
+	}
+
+	// 2) Otherwise, update labels and annotations
+	if namespace.Labels == nil {
+		namespace.Labels = make(map[string]string)
+	}
+	for key, value := range labels {
+		namespace.Labels[key] = value
+	}
+	if namespace.Annotations == nil {
+		namespace.Annotations = make(map[string]string)
+	}
+	for key, value := range annotations {
+		namespace.Annotations[key] = value
+	}
+
+	if _, err := namespaces.Update(ctx, namespace, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("Unable to update namespace '%s': %s", name, err)
+	}
+	return nil
+}
+
+// ListNamespaces returns all namespaces matching the given label selector.
+func (k *Kubernetes) ListNamespaces(selector string) ([]corev1.Namespace, error) {
+	options := metav1.ListOptions{LabelSelector: selector}
+	list, err := k.client.CoreV1().Namespaces().List(context.Background(), options)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to list namespaces: %s", err)
+	}
+	return list.Items, nil
+}
+
+// DeleteNamespace deletes the namespace with the given name along with all of its resources. It
+// does not fail if the namespace does not exist.
+func (k *Kubernetes) DeleteNamespace(name string) error {
+	err := k.client.CoreV1().Namespaces().Delete(
+		context.Background(), name, metav1.DeleteOptions{},
+	)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("Unable to delete namespace '%s': %s", name, err)
+	}
+	return nil
+}
+
+func (k *Kubernetes) resource(
+	gvk schema.GroupVersionKind, namespace string,
+) (dynamic.ResourceInterface, error) {
+	mapping, err := k.restMapping(gvk)
+	if err != nil {
+		return nil, err
+	}
+
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		return k.dynamic.Resource(mapping.Resource).Namespace(namespace), nil
+	}
+	return k.dynamic.Resource(mapping.Resource), nil
+}
+
+func (k *Kubernetes) restMapping(gvk schema.GroupVersionKind) (*meta.RESTMapping, error) {
+	mapping, err := k.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if meta.IsNoMatchError(err) {
+		// The resource might have been registered just now (e.g. by applying a CRD)
+		k.mapper.Reset()
+		mapping, err = k.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Unable to find resource for kind '%s': %s", gvk.Kind, err)
+	}
+	return mapping, nil
+}
+
+func replicasOrDefault(replicas *int32) int32 {
+	if replicas == nil {
+		return 1
+	}
+	return *replicas
+}
@@ -0,0 +1,512 @@
+package providers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strconv"
+
+	"go.borchero.com/cuckoo/utils"
+	"go.borchero.com/typewriter"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	k8syaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/kustomize/api/krusty"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+const (
+	manifestFieldManager   = "cuckoo"
+	manifestReleaseLabel   = "cuckoo.borchero.com/release"
+	manifestManagedByLabel = "app.kubernetes.io/managed-by"
+	manifestSecretType     = "cuckoo.borchero.com/release.v1"
+
+	manifestStatusDeployed   = "deployed"
+	manifestStatusSuperseded = "superseded"
+	manifestStatusFailed     = "failed"
+)
+
+// ManifestRelease describes the release of plain Kubernetes manifests (optionally rendered via
+// Kustomize) which are applied via server-side apply. All applied resources are labeled with the
+// name of the release such that resources which are removed from the manifests can be pruned.
+// Revisions are stored in secrets within the release's namespace to enable rollbacks.
+type ManifestRelease struct {
+	name      string
+	namespace string
+	kube      *Kubernetes
+	logger    typewriter.CLILogger
+}
+
+// ManifestSource describes the directory from which manifests are read. If Kustomize is set, the
+// directory is rendered as Kustomize overlay, otherwise all YAML and JSON files are read.
+type ManifestSource struct {
+	Dir       string
+	Kustomize bool
+}
+
+// ManifestRevision describes a single revision of a manifest release.
+type ManifestRevision struct {
+	Version int
+	Status  string
+	objects []*unstructured.Unstructured
+}
+
+// NewManifestRelease initializes a new manifest release with the given name in the given
+// namespace.
+func NewManifestRelease(
+	name, namespace string, logger typewriter.CLILogger,
+) (*ManifestRelease, error) {
+	kube, err := NewKubernetes()
+	if err != nil {
+		return nil, err
+	}
+
+	return &ManifestRelease{
+		name:      name,
+		namespace: namespace,
+		kube:      kube,
+		logger:    logger,
+	}, nil
+}
+
+// Apply renders the manifests from the given source and applies them. Afterwards, all resources of
+// the previously deployed revision which are not part of the manifests anymore are pruned and the
+// manifests are stored as new revision. At most maxHistory revisions are kept (0 for no limit).
+func (release *ManifestRelease) Apply(source ManifestSource, maxHistory int, dryRun bool) error {
+	// 1) Render manifests
+	manifest, err := renderManifests(source)
+	if err != nil {
+		return err
+	}
+
+	// 2) Parse objects
+	objects, err := parseManifestObjects(manifest)
+	if err != nil {
+		return err
+	}
+
+	// 3) Deploy
+	return release.deploy(objects, maxHistory, dryRun)
+}
+
+// Rollback re-applies the objects of the given revision (or the previously deployed revision if
+// the revision is 0) and stores them as new revision.
+func (release *ManifestRelease) Rollback(revision int, maxHistory int, dryRun bool) error {
+	// 1) Find revision to roll back to
+	revisions, err := release.History()
+	if err != nil {
+		return err
+	}
+
+	target := manifestRollbackTarget(revisions, revision)
+	if target == nil {
+		return fmt.Errorf("Cannot find revision to roll back to")
+	}
+
+	// 2) Deploy objects of revision
+	release.logger.Infof("Rolling back %s to revision %d...", release.name, target.Version)
+	return release.deploy(target.objects, maxHistory, dryRun)
+}
+
+// History returns all revisions of the release, ordered by ascending version.
+func (release *ManifestRelease) History() ([]*ManifestRevision, error) {
+	// 1) List secrets
+	ctx := context.Background()
+	options := metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("owner=cuckoo,name=%s", release.name),
+	}
+	secrets, err := release.kube.client.CoreV1().Secrets(release.namespace).List(ctx, options)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to list revisions of release: %s", err)
+	}
+
+	// 2) Decode revisions
+	result := make([]*ManifestRevision, 0, len(secrets.Items))
+	for _, secret := range secrets.Items {
+		if secret.Type != manifestSecretType {
+			continue
+		}
+
+		version, err := strconv.Atoi(secret.Labels["version"])
+		if err != nil {
+			return nil, fmt.Errorf("Revision '%s' has an invalid version: %s", secret.Name, err)
+		}
+
+		objects, err := decodeManifestObjects(secret.Data["release"])
+		if err != nil {
+			return nil, fmt.Errorf("Unable to decode revision '%s': %s", secret.Name, err)
+		}
+
+		result = append(result, &ManifestRevision{
+			Version: version, Status: secret.Labels["status"], objects: objects,
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Version < result[j].Version
+	})
+	return result, nil
+}
+
+func (release *ManifestRelease) deploy(
+	objects []*unstructured.Unstructured, maxHistory int, dryRun bool,
+) error {
+	// 1) Prepare objects
+	for _, object := range objects {
+		release.prepareObject(object)
+	}
+	sortManifestObjects(objects)
+
+	// 2) Get current state
+	revisions, err := release.History()
+	if err != nil {
+		return err
+	}
+
+	var current *ManifestRevision
+	version := 1
+	if len(revisions) > 0 {
+		version = revisions[len(revisions)-1].Version + 1
+	}
+	for i := len(revisions) - 1; i >= 0; i-- {
+		if revisions[i].Status == manifestStatusDeployed {
+			current = revisions[i]
+			break
+		}
+	}
+
+	// 3) Apply objects
+	release.logger.Infof("Applying %d objects for %s...", len(objects), release.name)
+	for _, object := range objects {
+		err := release.kube.Apply(object, manifestFieldManager, dryRun)
+		if err != nil {
+			if !dryRun {
+				release.storeRevision(version, manifestStatusFailed, objects)
+			}
+			return err
+		}
+	}
+
+	if dryRun {
+		return nil
+	}
+
+	// 4) Prune objects which are not part of the release anymore
+	if current != nil {
+		if err := release.prune(current.objects, objects); err != nil {
+			release.storeRevision(version, manifestStatusFailed, objects)
+			return err
+		}
+	}
+
+	// 5) Store revision
+	if err := release.storeRevision(version, manifestStatusDeployed, objects); err != nil {
+		return err
+	}
+	if current != nil {
+		if err := release.setRevisionStatus(current.Version, manifestStatusSuperseded); err != nil {
+			return err
+		}
+	}
+
+	// 6) Remove old revisions
+	revisions = append(revisions, &ManifestRevision{Version: version})
+	return release.cleanupHistory(revisions, maxHistory)
+}
+
+func (release *ManifestRelease) prepareObject(object *unstructured.Unstructured) {
+	// 1) Set labels
+	labels := object.GetLabels()
+	if labels == nil {
+		labels = make(map[string]string)
+	}
+	labels[manifestManagedByLabel] = "cuckoo"
+	labels[manifestReleaseLabel] = release.name
+	object.SetLabels(labels)
+
+	// 2) Set namespace
+	namespaced, err := release.kube.IsNamespaced(object.GroupVersionKind())
+	if err != nil {
+		// Resources defined by CRDs of the same release cannot be found yet, assume that they are
+		// namespaced
+		namespaced = true
+	}
+	if namespaced && object.GetNamespace() == "" {
+		object.SetNamespace(release.namespace)
+	}
+}
+
+func (release *ManifestRelease) prune(previous, current []*unstructured.Unstructured) error {
+	// 1) Get objects which are still present
+	keep := make(map[string]bool)
+	for _, object := range current {
+		keep[manifestObjectKey(object)] = true
+	}
+
+	// 2) Delete all others (in reverse order of creation)
+	for i := len(previous) - 1; i >= 0; i-- {
+		object := previous[i]
+		if keep[manifestObjectKey(object)] {
+			continue
+		}
+
+		// 2.1) Only delete objects which are owned by this release
+		gvk := object.GroupVersionKind()
+		live, err := release.kube.Get(gvk, object.GetNamespace(), object.GetName())
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("Unable to get %s '%s': %s", gvk.Kind, object.GetName(), err)
+		}
+		if live.GetLabels()[manifestReleaseLabel] != release.name {
+			release.logger.Infof(
+				"Not pruning %s '%s' as it is not owned by %s",
+				gvk.Kind, object.GetName(), release.name,
+			)
+			continue
+		}
+
+		// 2.2) Delete
+		release.logger.Infof("Pruning %s '%s'...", gvk.Kind, object.GetName())
+		if err := release.kube.Delete(gvk, object.GetNamespace(), object.GetName()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (release *ManifestRelease) storeRevision(
+	version int, status string, objects []*unstructured.Unstructured,
+) error {
+	data, err := encodeManifestObjects(objects)
+	if err != nil {
+		return fmt.Errorf("Unable to encode revision: %s", err)
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      release.revisionName(version),
+			Namespace: release.namespace,
+			Labels: map[string]string{
+				"owner":   "cuckoo",
+				"name":    release.name,
+				"version": strconv.Itoa(version),
+				"status":  status,
+			},
+		},
+		Type: manifestSecretType,
+		Data: map[string][]byte{"release": data},
+	}
+
+	ctx := context.Background()
+	secrets := release.kube.client.CoreV1().Secrets(release.namespace)
+	if _, err := secrets.Create(ctx, secret, metav1.CreateOptions{}); err != nil {
+		return fmt.Errorf("Unable to store revision %d: %s", version, err)
+	}
+	return nil
+}
+
+func (release *ManifestRelease) setRevisionStatus(version int, status string) error {
+	ctx := context.Background()
+	secrets := release.kube.client.CoreV1().Secrets(release.namespace)
+
+	secret, err := secrets.Get(ctx, release.revisionName(version), metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("Unable to get revision %d: %s", version, err)
+	}
+
+	secret.Labels["status"] = status
+	if _, err := secrets.Update(ctx, secret, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("Unable to update revision %d: %s", version, err)
+	}
+	return nil
+}
+
+func (release *ManifestRelease) cleanupHistory(
+	revisions []*ManifestRevision, maxHistory int,
+) error {
+	if maxHistory <= 0 || len(revisions) <= maxHistory {
+		return nil
+	}
+
+	ctx := context.Background()
+	secrets := release.kube.client.CoreV1().Secrets(release.namespace)
+	for _, revision := range revisions[:len(revisions)-maxHistory] {
+		name := release.revisionName(revision.Version)
+		err := secrets.Delete(ctx, name, metav1.DeleteOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("Unable to remove revision %d: %s", revision.Version, err)
+		}
+	}
+	return nil
+}
+
+func (release *ManifestRelease) revisionName(version int) string {
+	return fmt.Sprintf("cuckoo.release.v1.%s.v%d", release.name, version)
+}
+
+// manifestRollbackTarget returns the revision with the given version from the given revisions
+// (ordered by ascending version). If the version is 0, it returns the revision deployed before the
+// latest one, ignoring failed revisions. It returns nil if there is no such revision.
+func manifestRollbackTarget(revisions []*ManifestRevision, version int) *ManifestRevision {
+	if version != 0 {
+		for _, revision := range revisions {
+			if revision.Version == version {
+				return revision
+			}
+		}
+		return nil
+	}
+
+	deployed := 0
+	for i := len(revisions) - 1; i >= 0; i-- {
+		if revisions[i].Status == manifestStatusFailed {
+			continue
+		}
+		deployed++
+		if deployed == 2 {
+			return revisions[i]
+		}
+	}
+	return nil
+}
+
+func renderManifests(source ManifestSource) ([]byte, error) {
+	// 1) Render Kustomize overlay
+	if source.Kustomize {
+		kustomizer := krusty.MakeKustomizer(krusty.MakeDefaultOptions())
+		resources, err := kustomizer.Run(filesys.MakeFsOnDisk(), source.Dir)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to render Kustomize overlay: %s", err)
+		}
+
+		manifest, err := resources.AsYaml()
+		if err != nil {
+			return nil, fmt.Errorf("Unable to encode rendered Kustomize overlay: %s", err)
+		}
+		return manifest, nil
+	}
+
+	// 2) Otherwise, read plain manifests
+	files, err := utils.GetMatchingFiles("\\.(yaml|yml|json)$", source.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to find manifests: %s", err)
+	}
+
+	buf := new(bytes.Buffer)
+	for _, file := range files {
+		contents, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read manifest '%s': %s", file, err)
+		}
+		buf.WriteString("\n---\n")
+		buf.Write(contents)
+	}
+	return buf.Bytes(), nil
+}
+
+func parseManifestObjects(manifest []byte) ([]*unstructured.Unstructured, error) {
+	decoder := k8syaml.NewYAMLOrJSONDecoder(bytes.NewReader(manifest), 4096)
+
+	result := make([]*unstructured.Unstructured, 0)
+	for {
+		var object map[string]interface{}
+		if err := decoder.Decode(&object); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, fmt.Errorf("Unable to parse manifests: %s", err)
+		}
+		if len(object) == 0 {
+			continue
+		}
+
+		parsed := &unstructured.Unstructured{Object: object}
+		if parsed.GetKind() == "" || parsed.GetName() == "" {
+			return nil, fmt.Errorf("Manifests contain an object without kind or name")
+		}
+		result = append(result, parsed)
+	}
+	return result, nil
+}
+
+// sortManifestObjects sorts objects such that namespaces and custom resource definitions are
+// applied before any other objects.
+func sortManifestObjects(objects []*unstructured.Unstructured) {
+	priority := func(object *unstructured.Unstructured) int {
+		switch object.GetKind() {
+		case "Namespace":
+			return 0
+		case "CustomResourceDefinition":
+			return 1
+		default:
+			return 2
+		}
+	}
+
+	sort.SliceStable(objects, func(i, j int) bool {
+		return priority(objects[i]) < priority(objects[j])
+	})
+}
+
+func manifestObjectKey(object *unstructured.Unstructured) string {
+	gvk := object.GroupVersionKind()
+	return schema.GroupKind{Group: gvk.Group, Kind: gvk.Kind}.String() + "/" +
+		object.GetNamespace() + "/" + object.GetName()
+}
+
+func encodeManifestObjects(objects []*unstructured.Unstructured) ([]byte, error) {
+	raw := make([]map[string]interface{}, len(objects))
+	for i, object := range objects {
+		raw[i] = object.Object
+	}
+
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := new(bytes.Buffer)
+	writer := gzip.NewWriter(buf)
+	if _, err := writer.Write(data); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decodeManifestObjects(data []byte) ([]*unstructured.Unstructured, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	decompressed, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw []map[string]interface{}
+	if err := json.Unmarshal(decompressed, &raw); err != nil {
+		return nil, err
+	}
+
+	result := make([]*unstructured.Unstructured, len(raw))
+	for i, object := range raw {
+		result[i] = &unstructured.Unstructured{Object: object}
+	}
+	return result, nil
+}
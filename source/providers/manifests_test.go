@@ -0,0 +1,191 @@
+package providers
+
+import (
+	"testing"
+
+	"gotest.tools/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestParseManifestObjects(t *testing.T) {
+	testCases := []struct {
+		name     string
+		manifest string
+		keys     []string
+		err      string
+	}{
+		{
+			name: "MultipleDocuments",
+			manifest: `
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+  namespace: default
+---
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: server
+`,
+			keys: []string{"ConfigMap/default/config", "Deployment.apps//server"},
+		},
+		{
+			name:     "JSON",
+			manifest: `{"apiVersion": "v1", "kind": "Namespace", "metadata": {"name": "test"}}`,
+			keys:     []string{"Namespace//test"},
+		},
+		{
+			name:     "Empty",
+			manifest: "\n---\n",
+			keys:     []string{},
+		},
+		{
+			name:     "MissingName",
+			manifest: "apiVersion: v1\nkind: ConfigMap\nmetadata: {}\n",
+			err:      "object without kind or name",
+		},
+		{
+			name:     "MissingKind",
+			manifest: "apiVersion: v1\nmetadata:\n  name: config\n",
+			err:      "object without kind or name",
+		},
+		{
+			name:     "InvalidYAML",
+			manifest: "kind: ConfigMap\nmetadata: [\n",
+			err:      "Unable to parse manifests",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			objects, err := parseManifestObjects([]byte(testCase.manifest))
+			if testCase.err != "" {
+				assert.ErrorContains(t, err, testCase.err)
+				return
+			}
+			assert.NilError(t, err)
+			assert.DeepEqual(t, manifestObjectKeys(objects), testCase.keys)
+		})
+	}
+}
+
+func TestSortManifestObjects(t *testing.T) {
+	objects := []*unstructured.Unstructured{
+		manifestObject("apps/v1", "Deployment", "server"),
+		manifestObject("apiextensions.k8s.io/v1", "CustomResourceDefinition", "crd"),
+		manifestObject("v1", "ConfigMap", "config"),
+		manifestObject("v1", "Namespace", "first"),
+		manifestObject("v1", "Service", "server"),
+		manifestObject("v1", "Namespace", "second"),
+	}
+
+	sortManifestObjects(objects)
+	assert.DeepEqual(t, manifestObjectKeys(objects), []string{
+		"Namespace//first",
+		"Namespace//second",
+		"CustomResourceDefinition.apiextensions.k8s.io//crd",
+		"Deployment.apps//server",
+		"ConfigMap//config",
+		"Service//server",
+	})
+}
+
+func TestEncodeDecodeManifestObjects(t *testing.T) {
+	testCases := []struct {
+		name     string
+		manifest string
+	}{
+		{name: "Empty", manifest: ""},
+		{
+			name: "Objects",
+			manifest: `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: server
+  labels:
+    app: server
+spec:
+  replicas: 2
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+data:
+  key: value
+`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			objects, err := parseManifestObjects([]byte(testCase.manifest))
+			assert.NilError(t, err)
+
+			encoded, err := encodeManifestObjects(objects)
+			assert.NilError(t, err)
+
+			decoded, err := decodeManifestObjects(encoded)
+			assert.NilError(t, err)
+			assert.DeepEqual(t, decoded, objects)
+		})
+	}
+
+	_, err := decodeManifestObjects([]byte("not gzip"))
+	assert.Assert(t, err != nil)
+}
+
+func TestManifestRollbackTarget(t *testing.T) {
+	revisions := []*ManifestRevision{
+		{Version: 1, Status: manifestStatusSuperseded},
+		{Version: 2, Status: manifestStatusSuperseded},
+		{Version: 3, Status: manifestStatusFailed},
+		{Version: 4, Status: manifestStatusDeployed},
+		{Version: 5, Status: manifestStatusFailed},
+	}
+
+	testCases := []struct {
+		name      string
+		revisions []*ManifestRevision
+		version   int
+		target    int
+	}{
+		{name: "Previous", revisions: revisions, version: 0, target: 2},
+		{name: "Explicit", revisions: revisions, version: 3, target: 3},
+		{name: "UnknownVersion", revisions: revisions, version: 6},
+		{name: "SingleRevision", revisions: revisions[:1], version: 0},
+		{name: "NoRevisions", version: 0},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			target := manifestRollbackTarget(testCase.revisions, testCase.version)
+			if testCase.target == 0 {
+				assert.Assert(t, target == nil)
+				return
+			}
+			assert.Assert(t, target != nil)
+			assert.Equal(t, target.Version, testCase.target)
+		})
+	}
+}
+
+func manifestObject(apiVersion, kind, name string) *unstructured.Unstructured {
+	object := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	object.SetAPIVersion(apiVersion)
+	object.SetKind(kind)
+	object.SetName(name)
+	return object
+}
+
+func manifestObjectKeys(objects []*unstructured.Unstructured) []string {
+	keys := make([]string, len(objects))
+	for i, object := range objects {
+		keys[i] = manifestObjectKey(object)
+	}
+	return keys
+}
@@ -0,0 +1,8 @@
+package metrics
+
+// Provider is an interface that enables querying metrics from a monitoring system.
+type Provider interface {
+
+	// Query evaluates the given query and returns its (scalar) result or an error upon failure.
+	Query(query string) (float64, error)
+}
@@ -0,0 +1,89 @@
+package metrics
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type prometheus struct {
+	client  *http.Client
+	baseURL string
+}
+
+type prometheusResponse struct {
+	Status string `json:"status"`
+	Error  string `json:"error"`
+	Data   struct {
+		ResultType string          `json:"resultType"`
+		Result     json.RawMessage `json:"result"`
+	} `json:"data"`
+}
+
+type prometheusSample struct {
+	Value []interface{} `json:"value"`
+}
+
+// NewPrometheus creates a new metrics provider which queries the Prometheus-compatible HTTP API
+// served at the given base URL.
+func NewPrometheus(baseURL string) (Provider, error) {
+	if _, err := url.Parse(baseURL); err != nil {
+		return nil, fmt.Errorf("Invalid Prometheus URL: %s", err)
+	}
+
+	return &prometheus{
+		client:  &http.Client{Timeout: 30 * time.Second},
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+	}, nil
+}
+
+func (p *prometheus) Query(query string) (float64, error) {
+	// 1) Run query
+	endpoint := fmt.Sprintf("%s/api/v1/query?query=%s", p.baseURL, url.QueryEscape(query))
+	response, err := p.client.Get(endpoint)
+	if err != nil {
+		return 0, fmt.Errorf("Unable to query Prometheus: %s", err)
+	}
+	defer response.Body.Close()
+
+	var result prometheusResponse
+	if err := json.NewDecoder(response.Body).Decode(&result); err != nil {
+		return 0, fmt.Errorf("Unable to decode Prometheus response: %s", err)
+	}
+	if result.Status != "success" {
+		return 0, fmt.Errorf("Prometheus query failed: %s", result.Error)
+	}
+
+	// 2) Extract value
+	var value []interface{}
+	switch result.Data.ResultType {
+	case "scalar":
+		if err := json.Unmarshal(result.Data.Result, &value); err != nil {
+			return 0, fmt.Errorf("Unable to decode scalar result: %s", err)
+		}
+	case "vector":
+		var samples []prometheusSample
+		if err := json.Unmarshal(result.Data.Result, &samples); err != nil {
+			return 0, fmt.Errorf("Unable to decode vector result: %s", err)
+		}
+		if len(samples) != 1 {
+			return 0, fmt.Errorf("Query must yield a single sample but yields %d", len(samples))
+		}
+		value = samples[0].Value
+	default:
+		return 0, fmt.Errorf("Query result type '%s' is not supported", result.Data.ResultType)
+	}
+
+	if len(value) != 2 {
+		return 0, fmt.Errorf("Query yields malformed value")
+	}
+	text, ok := value[1].(string)
+	if !ok {
+		return 0, fmt.Errorf("Query yields malformed value")
+	}
+	return strconv.ParseFloat(text, 64)
+}
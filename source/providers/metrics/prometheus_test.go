@@ -0,0 +1,82 @@
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestPrometheusQuery(t *testing.T) {
+	testCases := []struct {
+		name     string
+		response string
+		value    float64
+		err      string
+	}{
+		{
+			name:     "Scalar",
+			response: `{"status":"success","data":{"resultType":"scalar","result":[1,"0.5"]}}`,
+			value:    0.5,
+		},
+		{
+			name: "Vector",
+			response: `{"status":"success","data":{"resultType":"vector",` +
+				`"result":[{"metric":{},"value":[1,"42"]}]}}`,
+			value: 42,
+		},
+		{
+			name: "VectorWithMultipleSamples",
+			response: `{"status":"success","data":{"resultType":"vector",` +
+				`"result":[{"value":[1,"1"]},{"value":[1,"2"]}]}}`,
+			err: "single sample but yields 2",
+		},
+		{
+			name:     "EmptyVector",
+			response: `{"status":"success","data":{"resultType":"vector","result":[]}}`,
+			err:      "single sample but yields 0",
+		},
+		{
+			name:     "Matrix",
+			response: `{"status":"success","data":{"resultType":"matrix","result":[]}}`,
+			err:      "not supported",
+		},
+		{
+			name:     "Error",
+			response: `{"status":"error","error":"parse error"}`,
+			err:      "Prometheus query failed: parse error",
+		},
+		{
+			name:     "MalformedValue",
+			response: `{"status":"success","data":{"resultType":"scalar","result":[1,2]}}`,
+			err:      "malformed value",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			var query string
+			handler := func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, r.URL.Path, "/api/v1/query")
+				query = r.URL.Query().Get("query")
+				fmt.Fprint(w, testCase.response)
+			}
+			server := httptest.NewServer(http.HandlerFunc(handler))
+			defer server.Close()
+
+			provider, err := NewPrometheus(server.URL + "/")
+			assert.NilError(t, err)
+
+			value, err := provider.Query(`sum(rate(errors{app="a b"}[5m]))`)
+			assert.Equal(t, query, `sum(rate(errors{app="a b"}[5m]))`)
+			if testCase.err != "" {
+				assert.ErrorContains(t, err, testCase.err)
+				return
+			}
+			assert.NilError(t, err)
+			assert.Equal(t, value, testCase.value)
+		})
+	}
+}
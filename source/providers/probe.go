@@ -0,0 +1,133 @@
+package providers
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.borchero.com/typewriter"
+)
+
+// HTTPProbe describes an HTTP endpoint which is expected to respond with a particular status code
+// and, optionally, a body matching a regular expression.
+type HTTPProbe struct {
+	URL    string
+	Status int
+	Body   *regexp.Regexp
+}
+
+// httpProbeSeparator matches the commas separating the key-value pairs of a probe.
+var httpProbeSeparator = regexp.MustCompile(`,(url|status|body)=`)
+
+// ParseHTTPProbe parses a probe from its textual representation 'url=<url>,status=<code>,
+// body=<regex>'. Only the URL is required, the status defaults to 200. Commas only separate values
+// if they are followed by a key such that URLs may contain commas. The body pattern must be given
+// last as it may contain arbitrary text.
+func ParseHTTPProbe(spec string) (HTTPProbe, error) {
+	probe := HTTPProbe{Status: http.StatusOK}
+
+	remainder := spec
+	for remainder != "" {
+		// 1) Get next key-value pair (the body consumes the remainder)
+		var pair string
+		if strings.HasPrefix(remainder, "body=") {
+			pair, remainder = remainder, ""
+		} else if index := httpProbeSeparator.FindStringIndex(remainder); index != nil {
+			pair, remainder = remainder[:index[0]], remainder[index[0]+1:]
+		} else {
+			pair, remainder = remainder, ""
+		}
+
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return probe, fmt.Errorf("Probe '%s' has wrong format", spec)
+		}
+
+		// 2) Set value
+		switch parts[0] {
+		case "url":
+			probe.URL = parts[1]
+		case "status":
+			status, err := strconv.Atoi(parts[1])
+			if err != nil {
+				return probe, fmt.Errorf("Probe '%s' has invalid status: %s", spec, err)
+			}
+			probe.Status = status
+		case "body":
+			pattern, err := regexp.Compile(parts[1])
+			if err != nil {
+				return probe, fmt.Errorf("Probe '%s' has invalid body pattern: %s", spec, err)
+			}
+			probe.Body = pattern
+		default:
+			return probe, fmt.Errorf("Probe '%s' has unknown key '%s'", spec, parts[0])
+		}
+	}
+
+	if probe.URL == "" {
+		return probe, fmt.Errorf("Probe '%s' does not specify a URL", spec)
+	}
+	return probe, nil
+}
+
+// Check sends a single request to the probe's URL and returns an error if the response does not
+// match the expectations.
+func (probe HTTPProbe) Check(client *http.Client) error {
+	response, err := client.Get(probe.URL)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != probe.Status {
+		return fmt.Errorf("Expected status %d but got %d", probe.Status, response.StatusCode)
+	}
+
+	if probe.Body != nil {
+		body, err := ioutil.ReadAll(response.Body)
+		if err != nil {
+			return fmt.Errorf("Unable to read response: %s", err)
+		}
+		if !probe.Body.Match(body) {
+			return fmt.Errorf("Response does not match '%s'", probe.Body)
+		}
+	}
+
+	return nil
+}
+
+// VerifyHTTPProbes checks all probes until they succeed. Each probe is attempted at most the given
+// number of times (at least once), waiting for the given interval between attempts.
+func VerifyHTTPProbes(
+	probes []HTTPProbe, attempts int, interval time.Duration, logger typewriter.CLILogger,
+) error {
+	if attempts < 1 {
+		return fmt.Errorf("Probes must be attempted at least once")
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+
+	for _, probe := range probes {
+		var err error
+		for attempt := 1; attempt <= attempts; attempt++ {
+			if err = probe.Check(client); err == nil {
+				break
+			}
+
+			logger.Infof("Probe %s failed (attempt %d/%d): %s", probe.URL, attempt, attempts, err)
+			if attempt < attempts {
+				time.Sleep(interval)
+			}
+		}
+
+		if err != nil {
+			return fmt.Errorf("Probe %s failed: %s", probe.URL, err)
+		}
+		logger.Infof("Probe %s succeeded", probe.URL)
+	}
+
+	return nil
+}
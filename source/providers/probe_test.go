@@ -0,0 +1,92 @@
+package providers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.borchero.com/typewriter"
+	"gotest.tools/assert"
+)
+
+func TestParseHTTPProbe(t *testing.T) {
+	probe, err := ParseHTTPProbe("url=https://example.com/health,status=204,body=ok|{\"a\",\"b\"}")
+	assert.NilError(t, err)
+	assert.Equal(t, probe.URL, "https://example.com/health", "URL is not parsed correctly.")
+	assert.Equal(t, probe.Status, 204, "Status is not parsed correctly.")
+	assert.Equal(t, probe.Body.String(), "ok|{\"a\",\"b\"}", "Body is not parsed correctly.")
+
+	probe, err = ParseHTTPProbe("url=https://example.com")
+	assert.NilError(t, err)
+	assert.Equal(t, probe.Status, 200, "Status does not default to 200.")
+	assert.Assert(t, probe.Body == nil, "Body must not be set.")
+
+	_, err = ParseHTTPProbe("status=200")
+	assert.ErrorContains(t, err, "does not specify a URL")
+
+	_, err = ParseHTTPProbe("foo=bar,url=https://example.com")
+	assert.ErrorContains(t, err, "unknown key")
+}
+
+func TestParseHTTPProbeURLWithCommas(t *testing.T) {
+	testCases := []struct {
+		spec   string
+		url    string
+		status int
+	}{
+		{"url=https://example.com/?ids=1,2,3", "https://example.com/?ids=1,2,3", 200},
+		{"url=https://example.com/?ids=1,2,status=503", "https://example.com/?ids=1,2", 503},
+		{"status=503,url=https://example.com/?ids=1,2", "https://example.com/?ids=1,2", 503},
+	}
+
+	for _, testCase := range testCases {
+		probe, err := ParseHTTPProbe(testCase.spec)
+		assert.NilError(t, err)
+		assert.Equal(t, probe.URL, testCase.url)
+		assert.Equal(t, probe.Status, testCase.status)
+	}
+}
+
+func TestVerifyHTTPProbesAttempts(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	probe, err := ParseHTTPProbe(fmt.Sprintf("url=%s", server.URL))
+	assert.NilError(t, err)
+	logger := typewriter.NewCLILogger()
+
+	// Probes without attempts must not pass
+	for _, attempts := range []int{0, -1} {
+		err := VerifyHTTPProbes([]HTTPProbe{probe}, attempts, 0, logger)
+		assert.ErrorContains(t, err, "at least once")
+	}
+	assert.Equal(t, requests, 0)
+
+	err = VerifyHTTPProbes([]HTTPProbe{probe}, 2, 0, logger)
+	assert.ErrorContains(t, err, "Expected status 200 but got 503")
+	assert.Equal(t, requests, 2)
+}
+
+func TestHTTPProbeCheck(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"status": "healthy"}`)
+	}))
+	defer server.Close()
+
+	probe, err := ParseHTTPProbe(fmt.Sprintf("url=%s,body=\"healthy\"", server.URL))
+	assert.NilError(t, err)
+	assert.NilError(t, probe.Check(server.Client()))
+
+	probe, err = ParseHTTPProbe(fmt.Sprintf("url=%s,status=204", server.URL))
+	assert.NilError(t, err)
+	assert.ErrorContains(t, probe.Check(server.Client()), "Expected status 204")
+
+	probe, err = ParseHTTPProbe(fmt.Sprintf("url=%s,body=unhealthy", server.URL))
+	assert.NilError(t, err)
+	assert.ErrorContains(t, probe.Check(server.Client()), "does not match")
+}
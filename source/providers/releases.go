@@ -0,0 +1,206 @@
+package providers
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"sync"
+
+	"gopkg.in/yaml.v2"
+)
+
+// HelmReleaseSpec describes a single Helm release within a releases file. Values which are not set
+// explicitly are taken from the command line.
+type HelmReleaseSpec struct {
+	Name         string   `yaml:"name"`
+	Namespace    string   `yaml:"namespace"`
+	Repo         string   `yaml:"repo"`
+	Chart        string   `yaml:"chart"`
+	Version      string   `yaml:"version"`
+	Image        string   `yaml:"image"`
+	Tag          string   `yaml:"tag"`
+	Values       []string `yaml:"values"`
+	SecretValues []string `yaml:"secretValues"`
+	Secrets      []string `yaml:"secrets"`
+	Set          []string `yaml:"set"`
+	SetString    []string `yaml:"setString"`
+	SetFile      []string `yaml:"setFile"`
+	SetJSON      []string `yaml:"setJson"`
+	Needs        []string `yaml:"needs"`
+}
+
+// HelmReleasesFile describes multiple Helm releases which are deployed together. Releases may
+// depend on other releases (via their names) which must be deployed successfully beforehand.
+type HelmReleasesFile struct {
+	Releases []HelmReleaseSpec `yaml:"releases"`
+}
+
+// ReadHelmReleasesFile reads the releases file at the given path and validates it.
+func ReadHelmReleasesFile(path string) (*HelmReleasesFile, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read releases file: %s", err)
+	}
+
+	var file HelmReleasesFile
+	if err := yaml.UnmarshalStrict(contents, &file); err != nil {
+		return nil, fmt.Errorf("Unable to parse releases file: %s", err)
+	}
+	if err := file.Validate(); err != nil {
+		return nil, fmt.Errorf("Invalid releases file: %s", err)
+	}
+	return &file, nil
+}
+
+// Validate returns an error if release names are not unique, a release depends on an unknown
+// release or dependencies are cyclic.
+func (file *HelmReleasesFile) Validate() error {
+	// 1) Index releases
+	releases := make(map[string]HelmReleaseSpec)
+	for _, release := range file.Releases {
+		if release.Name == "" {
+			return fmt.Errorf("Releases file contains a release without name")
+		}
+		if _, ok := releases[release.Name]; ok {
+			return fmt.Errorf("Release '%s' is defined multiple times", release.Name)
+		}
+		releases[release.Name] = release
+	}
+
+	for _, release := range file.Releases {
+		for _, need := range release.Needs {
+			if _, ok := releases[need]; !ok {
+				return fmt.Errorf(
+					"Release '%s' depends on unknown release '%s'", release.Name, need,
+				)
+			}
+		}
+	}
+
+	// 2) Check for cycles via depth-first search, releases on the current path are visiting
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	states := make(map[string]int)
+	var visit func(name string) bool
+	visit = func(name string) bool {
+		switch states[name] {
+		case visiting:
+			return false
+		case visited:
+			return true
+		}
+
+		states[name] = visiting
+		for _, need := range releases[name].Needs {
+			if !visit(need) {
+				return false
+			}
+		}
+		states[name] = visited
+		return true
+	}
+
+	for _, release := range file.Releases {
+		if !visit(release.Name) {
+			return fmt.Errorf("Releases have cyclic dependencies")
+		}
+	}
+	return nil
+}
+
+// Levels groups the releases into levels such that all releases of a level only depend on releases
+// of previous levels. Releases within a level are sorted by their name. An error is returned if the
+// releases are invalid (see Validate).
+func (file *HelmReleasesFile) Levels() ([][]HelmReleaseSpec, error) {
+	if err := file.Validate(); err != nil {
+		return nil, err
+	}
+
+	// Iteratively pick all releases whose dependencies have been picked, there is at least one such
+	// release in every iteration as dependencies are acyclic
+	result := make([][]HelmReleaseSpec, 0)
+	done := make(map[string]bool)
+	for len(done) < len(file.Releases) {
+		level := make([]HelmReleaseSpec, 0)
+		for _, release := range file.Releases {
+			if done[release.Name] {
+				continue
+			}
+
+			ready := true
+			for _, need := range release.Needs {
+				if !done[need] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				level = append(level, release)
+			}
+		}
+
+		sort.Slice(level, func(i, j int) bool {
+			return level[i].Name < level[j].Name
+		})
+		for _, release := range level {
+			done[release.Name] = true
+		}
+		result = append(result, level)
+	}
+
+	return result, nil
+}
+
+// Deploy calls the given function for all releases. Each release is deployed as soon as all of the
+// releases it needs have been deployed successfully, releases whose dependencies failed are
+// skipped. It returns the result of each release, keyed by name. The releases must be valid (see
+// Validate) which is always the case for files returned by ReadHelmReleasesFile.
+func (file *HelmReleasesFile) Deploy(deploy func(HelmReleaseSpec) error) map[string]error {
+	// 1) Initialize channels which are closed once a release finished
+	done := make(map[string]chan struct{})
+	for _, release := range file.Releases {
+		done[release.Name] = make(chan struct{})
+	}
+
+	// 2) Deploy all releases in parallel, waiting for their dependencies
+	results := make(map[string]error)
+	var mutex sync.Mutex
+	result := func(name string) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return results[name]
+	}
+
+	var wg sync.WaitGroup
+	for _, release := range file.Releases {
+		wg.Add(1)
+		go func(release HelmReleaseSpec) {
+			defer wg.Done()
+			defer close(done[release.Name])
+
+			// 2.1) Skip release if any dependency failed
+			var err error
+			for _, need := range release.Needs {
+				<-done[need]
+				if result(need) != nil {
+					err = fmt.Errorf("Skipped as release '%s' was not deployed", need)
+					break
+				}
+			}
+
+			// 2.2) Otherwise, deploy
+			if err == nil {
+				err = deploy(release)
+			}
+
+			mutex.Lock()
+			results[release.Name] = err
+			mutex.Unlock()
+		}(release)
+	}
+	wg.Wait()
+
+	return results
+}
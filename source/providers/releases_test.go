@@ -0,0 +1,154 @@
+package providers
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+)
+
+func TestHelmReleasesLevels(t *testing.T) {
+	file := HelmReleasesFile{
+		Releases: []HelmReleaseSpec{
+			{Name: "frontend", Needs: []string{"backend"}},
+			{Name: "backend", Needs: []string{"database", "cache"}},
+			{Name: "database"},
+			{Name: "cache"},
+			{Name: "monitoring"},
+		},
+	}
+
+	levels, err := file.Levels()
+	assert.NilError(t, err)
+
+	names := make([][]string, len(levels))
+	for i, level := range levels {
+		for _, release := range level {
+			names[i] = append(names[i], release.Name)
+		}
+	}
+	assert.DeepEqual(t, names, [][]string{
+		{"cache", "database", "monitoring"},
+		{"backend"},
+		{"frontend"},
+	})
+}
+
+func TestHelmReleasesValidate(t *testing.T) {
+	testCases := []struct {
+		name     string
+		releases []HelmReleaseSpec
+		err      string
+	}{
+		{
+			name: "Valid",
+			releases: []HelmReleaseSpec{
+				{Name: "a", Needs: []string{"b", "c"}},
+				{Name: "b", Needs: []string{"c"}},
+				{Name: "c"},
+			},
+		},
+		{
+			name: "Cyclic",
+			releases: []HelmReleaseSpec{
+				{Name: "a", Needs: []string{"b"}},
+				{Name: "b", Needs: []string{"c"}},
+				{Name: "c", Needs: []string{"a"}},
+			},
+			err: "cyclic",
+		},
+		{
+			name:     "SelfDependency",
+			releases: []HelmReleaseSpec{{Name: "a", Needs: []string{"a"}}},
+			err:      "cyclic",
+		},
+		{
+			name:     "UnknownDependency",
+			releases: []HelmReleaseSpec{{Name: "a", Needs: []string{"b"}}},
+			err:      "unknown release",
+		},
+		{
+			name:     "DuplicateName",
+			releases: []HelmReleaseSpec{{Name: "a"}, {Name: "a"}},
+			err:      "multiple times",
+		},
+		{
+			name:     "MissingName",
+			releases: []HelmReleaseSpec{{Name: "a"}, {}},
+			err:      "without name",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			file := HelmReleasesFile{Releases: testCase.releases}
+			err := file.Validate()
+			if testCase.err == "" {
+				assert.NilError(t, err)
+			} else {
+				assert.ErrorContains(t, err, testCase.err)
+			}
+		})
+	}
+}
+
+func TestHelmReleasesDeploy(t *testing.T) {
+	file := HelmReleasesFile{
+		Releases: []HelmReleaseSpec{
+			{Name: "slow"},
+			{Name: "database"},
+			{Name: "backend", Needs: []string{"database"}},
+			{Name: "frontend", Needs: []string{"backend", "slow"}},
+			{Name: "broken"},
+			{Name: "worker", Needs: []string{"broken"}},
+			{Name: "cron", Needs: []string{"worker"}},
+		},
+	}
+
+	// The slow release only finishes once the backend was deployed, i.e. the backend must not
+	// wait for releases it does not need
+	backend := make(chan struct{})
+	var mutex sync.Mutex
+	deployed := make(map[string]bool)
+	premature := make([]string, 0)
+	deploy := func(spec HelmReleaseSpec) error {
+		mutex.Lock()
+		for _, need := range spec.Needs {
+			if !deployed[need] {
+				premature = append(premature, spec.Name)
+			}
+		}
+		mutex.Unlock()
+
+		switch spec.Name {
+		case "slow":
+			select {
+			case <-backend:
+			case <-time.After(5 * time.Second):
+				return fmt.Errorf("backend was not deployed")
+			}
+		case "backend":
+			close(backend)
+		case "broken":
+			return fmt.Errorf("deployment failed")
+		}
+
+		mutex.Lock()
+		deployed[spec.Name] = true
+		mutex.Unlock()
+		return nil
+	}
+
+	results := file.Deploy(deploy)
+	assert.Equal(t, len(results), len(file.Releases))
+	assert.DeepEqual(t, premature, []string{})
+	for _, name := range []string{"slow", "database", "backend", "frontend"} {
+		assert.NilError(t, results[name])
+	}
+	assert.ErrorContains(t, results["broken"], "deployment failed")
+	assert.ErrorContains(t, results["worker"], "Skipped as release 'broken'")
+	assert.ErrorContains(t, results["cron"], "Skipped as release 'worker'")
+	assert.Assert(t, !deployed["worker"] && !deployed["cron"])
+}
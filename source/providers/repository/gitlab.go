@@ -28,14 +28,23 @@ func NewGitlabRepo(serverHost, user, password, projectID string) (*GitlabRepo, e
 func (repo *GitlabRepo) Branches() ([]string, error) {
 	options := &gitlab.ListBranchesOptions{}
 	options.PerPage = 100
-	branches, _, err := repo.client.Branches.ListBranches(repo.id, options)
-	if err != nil {
-		return nil, err
-	}
-
-	result := make([]string, len(branches))
-	for i, branch := range branches {
-		result[i] = branch.Name
+	options.Page = 1
+
+	result := make([]string, 0)
+	for {
+		branches, response, err := repo.client.Branches.ListBranches(repo.id, options)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, branch := range branches {
+			result = append(result, branch.Name)
+		}
+
+		if response.NextPage == 0 {
+			break
+		}
+		options.Page = response.NextPage
 	}
 
 	return result, nil
@@ -0,0 +1,140 @@
+package providers
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"go.borchero.com/cuckoo/providers/metrics"
+	"go.borchero.com/cuckoo/providers/traffic"
+	"go.borchero.com/typewriter"
+)
+
+// CanaryAnalysis describes a metric which is checked between the steps of a canary rollout. The
+// rollout is aborted if the metric's value exceeds the given maximum or the query does not yield a
+// value.
+type CanaryAnalysis struct {
+	Metrics metrics.Provider
+	Query   string
+	Max     float64
+}
+
+// RolloutRelease is a release which can be rolled out progressively.
+type RolloutRelease interface {
+
+	// Upgrade installs or upgrades the release with the given values and options.
+	Upgrade(values HelmValues, options HelmUpgradeOptions) error
+
+	// Uninstall removes the release.
+	Uninstall(options HelmUpgradeOptions) error
+}
+
+// CanaryRollout describes the progressive rollout of a new version of a release: the new version
+// is deployed as separate canary release and traffic is shifted to it in steps. If all steps
+// succeed, the stable release is upgraded and the canary release is removed. Blue/green
+// deployments are canary rollouts with a single step of 100%. The canary release is verified
+// before any traffic is shifted to it, if a verification is given.
+type CanaryRollout struct {
+	Stable   RolloutRelease
+	Canary   RolloutRelease
+	Traffic  traffic.Provider
+	Steps    []int
+	Interval time.Duration
+	Analysis *CanaryAnalysis
+	Verify   func() error
+	Logger   typewriter.CLILogger
+}
+
+// Run performs the rollout with the given values and options. If any step fails, all traffic is
+// routed back to the stable release, the canary release is removed and an error is returned.
+func (rollout *CanaryRollout) Run(values HelmValues, options HelmUpgradeOptions) error {
+	// 1) Validate steps
+	previous := 0
+	for _, step := range rollout.Steps {
+		if step <= previous || step > 100 {
+			return fmt.Errorf("Steps must be increasing percentages between 1 and 100")
+		}
+		previous = step
+	}
+
+	// 2) Deploy canary such that it does not receive any traffic until the first step
+	canaryValues := values
+	canaryValues.StringValues = append(
+		append([]string{}, values.StringValues...), rollout.Traffic.CanaryValues()...,
+	)
+	if err := rollout.Canary.Upgrade(canaryValues, options); err != nil {
+		return rollout.abort(fmt.Errorf("Unable to deploy canary: %s", err), options)
+	}
+
+	if rollout.Verify != nil {
+		if err := rollout.Verify(); err != nil {
+			return rollout.abort(err, options)
+		}
+	}
+
+	// 3) Shift traffic step by step
+	for _, weight := range rollout.Steps {
+		rollout.Logger.Infof("Routing %d%% of traffic to canary...", weight)
+		if err := rollout.Traffic.SetCanaryWeight(weight); err != nil {
+			return rollout.abort(err, options)
+		}
+
+		time.Sleep(rollout.Interval)
+		if err := rollout.analyze(); err != nil {
+			return rollout.abort(err, options)
+		}
+	}
+
+	// 4) Promote canary
+	rollout.Logger.Infof("Promoting canary...")
+	if err := rollout.Stable.Upgrade(values, options); err != nil {
+		return rollout.abort(fmt.Errorf("Unable to promote canary: %s", err), options)
+	}
+
+	// The canary must be removed even if traffic cannot be routed back, it would be leaked
+	// otherwise
+	if err := rollout.Traffic.SetCanaryWeight(0); err != nil {
+		err = fmt.Errorf("Unable to route traffic to stable release: %s", err)
+		if uninstallErr := rollout.Canary.Uninstall(options); uninstallErr != nil {
+			return fmt.Errorf("%s (failed to remove canary: %s)", err, uninstallErr)
+		}
+		return err
+	}
+	return rollout.Canary.Uninstall(options)
+}
+
+func (rollout *CanaryRollout) analyze() error {
+	if rollout.Analysis == nil {
+		return nil
+	}
+
+	value, err := rollout.Analysis.Metrics.Query(rollout.Analysis.Query)
+	if err != nil {
+		return err
+	}
+
+	// A query without data (e.g. an error ratio without any requests) must not promote the canary
+	if math.IsNaN(value) {
+		return fmt.Errorf("Metric value is not a number")
+	}
+
+	rollout.Logger.Infof("Metric value is %g (maximum %g)", value, rollout.Analysis.Max)
+	if value > rollout.Analysis.Max {
+		return fmt.Errorf("Metric value %g exceeds maximum %g", value, rollout.Analysis.Max)
+	}
+	return nil
+}
+
+func (rollout *CanaryRollout) abort(cause error, options HelmUpgradeOptions) error {
+	rollout.Logger.Errorf("Aborting rollout: %s", cause)
+
+	// The canary's ingress might not exist if deploying the canary failed
+	if err := rollout.Traffic.SetCanaryWeight(0); err != nil {
+		rollout.Logger.Errorf("Failed to route traffic back to stable release: %s", err)
+	}
+	if err := rollout.Canary.Uninstall(options); err != nil {
+		rollout.Logger.Errorf("Failed to remove canary: %s", err)
+	}
+
+	return fmt.Errorf("Rollout aborted: %s", cause)
+}
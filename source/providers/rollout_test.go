@@ -0,0 +1,175 @@
+package providers
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"go.borchero.com/typewriter"
+	"gotest.tools/assert"
+)
+
+type fakeRelease struct {
+	upgrades   []HelmValues
+	uninstalls int
+	failures   int
+}
+
+func (r *fakeRelease) Upgrade(values HelmValues, options HelmUpgradeOptions) error {
+	r.upgrades = append(r.upgrades, values)
+	if r.failures > 0 {
+		r.failures--
+		return fmt.Errorf("upgrade failed")
+	}
+	return nil
+}
+
+func (r *fakeRelease) Uninstall(options HelmUpgradeOptions) error {
+	r.uninstalls++
+	return nil
+}
+
+type fakeTraffic struct {
+	weights   []int
+	fail      int
+	failReset bool
+}
+
+func (f *fakeTraffic) SetCanaryWeight(weight int) error {
+	f.weights = append(f.weights, weight)
+	if (f.fail != 0 && weight == f.fail) || (f.failReset && weight == 0) {
+		return fmt.Errorf("traffic failed")
+	}
+	return nil
+}
+
+func (f *fakeTraffic) CanaryValues() []string {
+	return []string{"canary=true"}
+}
+
+type fakeMetrics struct {
+	values  []float64
+	err     error
+	queries []string
+}
+
+func (m *fakeMetrics) Query(query string) (float64, error) {
+	m.queries = append(m.queries, query)
+	if m.err != nil {
+		return 0, m.err
+	}
+	if len(m.queries) > len(m.values) {
+		return 0, fmt.Errorf("query failed")
+	}
+	return m.values[len(m.queries)-1], nil
+}
+
+func TestCanaryRollout(t *testing.T) {
+	testCases := []struct {
+		name           string
+		steps          []int
+		metrics        []float64
+		metricsErr     error
+		canaryFailures int
+		trafficFail    int
+		trafficReset   bool
+		verifyErr      error
+		err            string
+		weights        []int
+		canaryUpgrades int
+		stableUpgrades int
+		queries        int
+	}{
+		{
+			name: "Success", steps: []int{10, 50, 100}, metrics: []float64{0, 1, 2},
+			weights: []int{10, 50, 100, 0}, canaryUpgrades: 1, stableUpgrades: 1, queries: 3,
+		},
+		{
+			name: "AnalysisExceedsMax", steps: []int{10, 50, 100}, metrics: []float64{1, 6},
+			err: "exceeds maximum", weights: []int{10, 50, 0}, canaryUpgrades: 1, queries: 2,
+		},
+		{
+			name: "AnalysisQueryFails", steps: []int{10, 50}, metrics: []float64{1},
+			err: "query failed", weights: []int{10, 50, 0}, canaryUpgrades: 1, queries: 2,
+		},
+		{
+			name: "AnalysisNaN", steps: []int{10, 50}, metrics: []float64{math.NaN()},
+			err: "not a number", weights: []int{10, 0}, canaryUpgrades: 1, queries: 1,
+		},
+		{
+			name: "AnalysisEmptyResult", steps: []int{10, 50},
+			metricsErr: fmt.Errorf("Query must yield a single sample but yields 0"),
+			err:        "yields 0", weights: []int{10, 0}, canaryUpgrades: 1, queries: 1,
+		},
+		{
+			name: "CanaryDeploymentFails", steps: []int{100}, canaryFailures: 1,
+			err: "Unable to deploy canary", weights: []int{0}, canaryUpgrades: 1,
+		},
+		{
+			name: "VerificationFails", steps: []int{100}, verifyErr: fmt.Errorf("tests failed"),
+			err: "tests failed", weights: []int{0}, canaryUpgrades: 1,
+		},
+		{
+			name: "TrafficShiftFails", steps: []int{10, 50}, metrics: []float64{0},
+			trafficFail: 50, err: "traffic failed", weights: []int{10, 50, 0},
+			canaryUpgrades: 1, queries: 1,
+		},
+		{
+			name: "TrafficResetFailsAfterPromotion", steps: []int{100}, metrics: []float64{0},
+			trafficReset: true, err: "Unable to route traffic to stable release",
+			weights: []int{100, 0}, canaryUpgrades: 1, stableUpgrades: 1, queries: 1,
+		},
+		{
+			name: "InvalidSteps", steps: []int{50, 10}, err: "Steps must be increasing",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			stable := &fakeRelease{}
+			canary := &fakeRelease{failures: testCase.canaryFailures}
+			router := &fakeTraffic{fail: testCase.trafficFail, failReset: testCase.trafficReset}
+			metrics := &fakeMetrics{values: testCase.metrics, err: testCase.metricsErr}
+
+			rollout := CanaryRollout{
+				Stable:   stable,
+				Canary:   canary,
+				Traffic:  router,
+				Steps:    testCase.steps,
+				Analysis: &CanaryAnalysis{Metrics: metrics, Query: "errors", Max: 5},
+				Logger:   typewriter.NewCLILogger(),
+			}
+			if testCase.verifyErr != nil {
+				rollout.Verify = func() error {
+					return testCase.verifyErr
+				}
+			}
+
+			values := HelmValues{StringValues: []string{"a=b"}}
+			err := rollout.Run(values, HelmUpgradeOptions{})
+			if testCase.err == "" {
+				assert.NilError(t, err)
+			} else {
+				assert.ErrorContains(t, err, testCase.err)
+			}
+
+			assert.DeepEqual(t, router.weights, testCase.weights)
+			assert.Equal(t, len(canary.upgrades), testCase.canaryUpgrades)
+			assert.Equal(t, len(stable.upgrades), testCase.stableUpgrades)
+			assert.Equal(t, len(metrics.queries), testCase.queries)
+
+			// The canary is always removed once it was deployed
+			assert.Equal(t, canary.uninstalls, testCase.canaryUpgrades)
+
+			// The canary must be installed without traffic, the stable release without canary
+			// values
+			if testCase.canaryUpgrades > 0 {
+				expected := []string{"a=b", "canary=true"}
+				assert.DeepEqual(t, canary.upgrades[0].StringValues, expected)
+			}
+			if testCase.stableUpgrades > 0 {
+				assert.DeepEqual(t, stable.upgrades[0].StringValues, []string{"a=b"})
+			}
+		})
+	}
+}
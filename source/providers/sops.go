@@ -1,32 +1,497 @@
 package providers
 
 import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 
+	filippoage "filippo.io/age"
+	gosops "go.mozilla.org/sops/v3"
+	"go.mozilla.org/sops/v3/aes"
+	"go.mozilla.org/sops/v3/age"
+	"go.mozilla.org/sops/v3/cmd/sops/common"
+	"go.mozilla.org/sops/v3/cmd/sops/formats"
+	"go.mozilla.org/sops/v3/config"
 	"go.mozilla.org/sops/v3/decrypt"
+	"go.mozilla.org/sops/v3/gcpkms"
+	"go.mozilla.org/sops/v3/keys"
+	"go.mozilla.org/sops/v3/keyservice"
+	"go.mozilla.org/sops/v3/kms"
+	"go.mozilla.org/sops/v3/pgp"
+	"go.mozilla.org/sops/v3/version"
+	"helm.sh/helm/v3/pkg/chartutil"
 )
 
-// Sops decrypts files with Mozilla's sops tool.
+const sopsAgeKeyEnv = "SOPS_AGE_KEY"
+
+var environmentNamePattern = regexp.MustCompile("[^A-Z0-9_]")
+
+// SopsFormats lists all file formats understood by Sops.
+var SopsFormats = []string{"yaml", "json", "ini", "dotenv", "binary"}
+
+// Sops encrypts and decrypts files with Mozilla's sops tool. Age identities are read from the
+// SOPS_AGE_KEY environment variable or the file given by SOPS_AGE_KEY_FILE.
 type Sops struct {
+	keyServices []keyservice.KeyServiceClient
+	format      string
+}
+
+// SopsKeys describes master keys of different types. Each entry may be a comma-separated list of
+// keys.
+type SopsKeys struct {
+	PGP    []string
+	Age    []string
+	KMS    []string
+	GCPKMS []string
 }
 
-// NewSops returns a new Sops instance to decrypt files.
+// NewSops returns a new Sops instance to encrypt and decrypt files.
 func NewSops() *Sops {
-	return &Sops{}
+	return &Sops{
+		keyServices: []keyservice.KeyServiceClient{keyservice.NewLocalClient()},
+	}
+}
+
+// SetFormat sets the format of all files that are encrypted or decrypted, overriding the format
+// detected from the file names. An empty format restores detection.
+func (sops *Sops) SetFormat(format string) error {
+	if format == "" {
+		sops.format = ""
+		return nil
+	}
+	for _, known := range SopsFormats {
+		if format == known {
+			sops.format = format
+			return nil
+		}
+	}
+	return fmt.Errorf("Unknown format '%s', must be one of %s", format, SopsFormats)
 }
 
 // Decrypt decrypts the file at the given directory and returns its contents.
 func (sops *Sops) Decrypt(file string) ([]byte, error) {
-	// 1) Get extension
-	splits := strings.Split(file, ".")
-	extension := splits[len(splits)-1]
-
-	// // 2) Decrypt
-	if extension == "env" {
-		return decrypt.File(file, "dotenv")
-	} else if extension == "json" || extension == "yaml" {
-		return decrypt.File(file, extension)
-	} else {
-		return decrypt.File(file, "binary")
+	if err := checkAgeKey(); err != nil {
+		return nil, err
+	}
+	return decrypt.File(file, sops.fileFormat(file))
+}
+
+// Encrypt encrypts the given file and returns the encrypted contents. Master keys and encryption
+// settings are read from the creation rule of the config file (.sops.yaml) matching the given
+// target path. If no config file is given, it is searched in the current directory and its parents.
+func (sops *Sops) Encrypt(file, target, configFile string) ([]byte, error) {
+	// 1) Load creation rule
+	conf, err := creationRule(configFile, target)
+	if err != nil {
+		return nil, err
+	}
+
+	// 2) Read file
+	contents, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read file: %s", err)
+	}
+
+	store := sops.store(file)
+	branches, err := store.LoadPlainFile(contents)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse file: %s", err)
+	}
+
+	// 3) Encrypt
+	tree := gosops.Tree{
+		Branches: branches,
+		Metadata: gosops.Metadata{
+			KeyGroups:         conf.KeyGroups,
+			UnencryptedSuffix: conf.UnencryptedSuffix,
+			EncryptedSuffix:   conf.EncryptedSuffix,
+			UnencryptedRegex:  conf.UnencryptedRegex,
+			EncryptedRegex:    conf.EncryptedRegex,
+			ShamirThreshold:   conf.ShamirThreshold,
+			Version:           version.Version,
+		},
+		FilePath: file,
+	}
+
+	if err := sops.encryptTree(&tree); err != nil {
+		return nil, err
+	}
+	return store.EmitEncryptedFile(tree)
+}
+
+// Rotate re-encrypts the given encrypted file with a new data key and returns the encrypted
+// contents. The given master keys are added to the first key group and removed from all key
+// groups, respectively.
+func (sops *Sops) Rotate(file string, add, remove SopsKeys) ([]byte, error) {
+	// 1) Parse keys
+	addKeys, err := add.masterKeys()
+	if err != nil {
+		return nil, err
+	}
+	removeKeys, err := remove.masterKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	// 2) Decrypt file
+	store := sops.store(file)
+	tree, err := sops.decryptTree(file, store)
+	if err != nil {
+		return nil, err
+	}
+
+	// 3) Update keys
+	if len(addKeys) > 0 {
+		if len(tree.Metadata.KeyGroups) == 0 {
+			tree.Metadata.KeyGroups = []gosops.KeyGroup{{}}
+		}
+		tree.Metadata.KeyGroups[0] = append(tree.Metadata.KeyGroups[0], addKeys...)
+	}
+
+	for _, removeKey := range removeKeys {
+		for i, group := range tree.Metadata.KeyGroups {
+			filtered := make(gosops.KeyGroup, 0, len(group))
+			for _, key := range group {
+				if key.ToString() != removeKey.ToString() {
+					filtered = append(filtered, key)
+				}
+			}
+			tree.Metadata.KeyGroups[i] = filtered
+		}
+	}
+
+	// 4) Encrypt with new data key
+	if err := sops.encryptTree(tree); err != nil {
+		return nil, err
+	}
+	return store.EmitEncryptedFile(*tree)
+}
+
+// UpdateKeys updates the master keys of the given encrypted file to the keys of the creation rule
+// matching the file. The data key is kept. It returns the encrypted contents along with a flag
+// whether the keys changed.
+func (sops *Sops) UpdateKeys(file, configFile string) ([]byte, bool, error) {
+	// 1) Load creation rule
+	conf, err := creationRule(configFile, file)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// 2) Load file
+	store := sops.store(file)
+	tree, err := sops.loadTree(file, store)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if keyGroupsEqual(tree.Metadata.KeyGroups, conf.KeyGroups) {
+		return nil, false, nil
+	}
+
+	// 3) Update keys
+	dataKey, err := tree.Metadata.GetDataKeyWithKeyServices(sops.keyServices)
+	if err != nil {
+		return nil, false, fmt.Errorf("Unable to get data key: %s", err)
+	}
+
+	tree.Metadata.KeyGroups = conf.KeyGroups
+	tree.Metadata.ShamirThreshold = conf.ShamirThreshold
+	if tree.Metadata.ShamirThreshold > len(tree.Metadata.KeyGroups) {
+		tree.Metadata.ShamirThreshold = len(tree.Metadata.KeyGroups)
+	}
+
+	errs := tree.Metadata.UpdateMasterKeysWithKeyServices(dataKey, sops.keyServices)
+	if len(errs) > 0 {
+		return nil, false, fmt.Errorf("Unable to update master keys: %s", errs)
+	}
+
+	contents, err := store.EmitEncryptedFile(*tree)
+	if err != nil {
+		return nil, false, err
+	}
+	return contents, true, nil
+}
+
+// DecryptEnvironment decrypts the given dotenv, YAML or JSON file and returns its values as
+// environment variables (KEY=value), sorted by key. Nested keys are joined with underscores, all
+// names are uppercased and prefixed with the given prefix.
+func (sops *Sops) DecryptEnvironment(file, prefix string) ([]string, error) {
+	// 1) Decrypt
+	contents, err := sops.Decrypt(file)
+	if err != nil {
+		return nil, err
+	}
+
+	// 2) Parse values
+	var values interface{}
+	switch sops.fileFormat(file) {
+	case "dotenv":
+		dotenv, err := parseDotenv(contents)
+		if err != nil {
+			return nil, err
+		}
+		parsed := make(map[string]interface{})
+		for key, value := range dotenv {
+			parsed[key] = value
+		}
+		values = parsed
+	case "yaml", "json":
+		parsed, err := chartutil.ReadValues(contents)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to parse decrypted file: %s", err)
+		}
+		values = map[string]interface{}(parsed)
+	default:
+		return nil, fmt.Errorf("Only dotenv, YAML and JSON files can be used as environment")
+	}
+
+	// 3) Flatten values
+	flattened := make(map[string]string)
+	flattenEnvironment(prefix, values, flattened)
+
+	result := make([]string, 0, len(flattened))
+	for key, value := range flattened {
+		result = append(result, fmt.Sprintf("%s=%s", key, value))
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+func (sops *Sops) loadTree(file string, store common.Store) (*gosops.Tree, error) {
+	if err := checkAgeKey(); err != nil {
+		return nil, err
+	}
+
+	tree, err := common.LoadEncryptedFileWithBugFixes(common.GenericDecryptOpts{
+		Cipher:      aes.NewCipher(),
+		InputStore:  store,
+		InputPath:   file,
+		KeyServices: sops.keyServices,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to load encrypted file: %s", err)
+	}
+	return tree, nil
+}
+
+func (sops *Sops) decryptTree(file string, store common.Store) (*gosops.Tree, error) {
+	tree, err := sops.loadTree(file, store)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = common.DecryptTree(common.DecryptTreeOpts{
+		Cipher:      aes.NewCipher(),
+		Tree:        tree,
+		KeyServices: sops.keyServices,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to decrypt file: %s", err)
+	}
+	return tree, nil
+}
+
+func (sops *Sops) encryptTree(tree *gosops.Tree) error {
+	dataKey, errs := tree.GenerateDataKeyWithKeyServices(sops.keyServices)
+	if len(errs) > 0 {
+		return fmt.Errorf("Unable to generate data key: %s", errs)
+	}
+
+	err := common.EncryptTree(common.EncryptTreeOpts{
+		DataKey: dataKey,
+		Tree:    tree,
+		Cipher:  aes.NewCipher(),
+	})
+	if err != nil {
+		return fmt.Errorf("Unable to encrypt file: %s", err)
+	}
+	return nil
+}
+
+// creationRule returns the creation rule of the given config file matching the given path. If no
+// config file is given, it is searched in the current directory and its parents.
+func creationRule(configFile, path string) (*config.Config, error) {
+	if configFile == "" {
+		found, err := config.FindConfigFile(".")
+		if err != nil {
+			return nil, fmt.Errorf("Unable to find Sops config file: %s", err)
+		}
+		configFile = found
+	}
+
+	conf, err := config.LoadCreationRuleForFile(configFile, path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to load creation rule: %s", err)
+	}
+	if conf == nil || len(conf.KeyGroups) == 0 {
+		return nil, fmt.Errorf("No creation rule with keys matches '%s'", path)
+	}
+	return conf, nil
+}
+
+func (keySpec SopsKeys) masterKeys() ([]keys.MasterKey, error) {
+	result := make([]keys.MasterKey, 0)
+	for _, fingerprints := range keySpec.PGP {
+		for _, key := range pgp.MasterKeysFromFingerprintString(fingerprints) {
+			result = append(result, key)
+		}
+	}
+	for _, recipients := range keySpec.Age {
+		ageKeys, err := age.MasterKeysFromRecipients(recipients)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid age recipients: %s", err)
+		}
+		for _, key := range ageKeys {
+			result = append(result, key)
+		}
+	}
+	for _, arns := range keySpec.KMS {
+		for _, key := range kms.MasterKeysFromArnString(arns, nil, "") {
+			result = append(result, key)
+		}
+	}
+	for _, resourceIDs := range keySpec.GCPKMS {
+		for _, key := range gcpkms.MasterKeysFromResourceIDString(resourceIDs) {
+			result = append(result, key)
+		}
+	}
+	return result, nil
+}
+
+func keyGroupsEqual(lhs, rhs []gosops.KeyGroup) bool {
+	if len(lhs) != len(rhs) {
+		return false
+	}
+	for i := range lhs {
+		if len(lhs[i]) != len(rhs[i]) {
+			return false
+		}
+		existing := make(map[string]bool)
+		for _, key := range lhs[i] {
+			existing[key.ToString()] = true
+		}
+		for _, key := range rhs[i] {
+			if !existing[key.ToString()] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// flattenEnvironment adds the given value to the result using the given name. Maps and lists are
+// flattened recursively by appending their keys (or indices) to the name.
+func flattenEnvironment(name string, value interface{}, result map[string]string) {
+	join := func(key string) string {
+		key = environmentNamePattern.ReplaceAllString(strings.ToUpper(key), "_")
+		if name == "" || strings.HasSuffix(name, "_") {
+			return name + key
+		}
+		return name + "_" + key
+	}
+
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		for key, nested := range typed {
+			flattenEnvironment(join(key), nested, result)
+		}
+	case []interface{}:
+		for i, nested := range typed {
+			flattenEnvironment(join(strconv.Itoa(i)), nested, result)
+		}
+	case nil:
+		result[name] = ""
+	case float64:
+		result[name] = strconv.FormatFloat(typed, 'f', -1, 64)
+	default:
+		result[name] = fmt.Sprint(typed)
+	}
+}
+
+// parseDotenv parses the given contents of a dotenv file. Empty lines and comments are ignored.
+func parseDotenv(contents []byte) (map[string]string, error) {
+	result := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(contents))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("Invalid line in dotenv file")
+		}
+		result[parts[0]] = parts[1]
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// checkAgeKey verifies that the age identities given by SOPS_AGE_KEY (if any) can be parsed.
+// Sops silently skips invalid identities and only fails with a generic error otherwise.
+func checkAgeKey() error {
+	key, ok := os.LookupEnv(sopsAgeKeyEnv)
+	if !ok {
+		return nil
+	}
+	if _, err := filippoage.ParseIdentities(strings.NewReader(key)); err != nil {
+		return fmt.Errorf("Invalid age key in %s: %s", sopsAgeKeyEnv, err)
+	}
+	return nil
+}
+
+func (sops *Sops) store(file string) common.Store {
+	return common.StoreForFormat(formats.FormatFromString(sops.fileFormat(file)))
+}
+
+// fileFormat returns the format set explicitly or, if not set, the one detected from the file.
+func (sops *Sops) fileFormat(file string) string {
+	if sops.format != "" {
+		return sops.format
+	}
+	return sopsFormat(file)
+}
+
+// sopsFormat returns the format of the given file as understood by Sops. It is detected from the
+// extensions of the file's name, ignoring any 'enc' and 'dec' parts: 'secrets.enc.yml' is a YAML
+// file and '.env.production' is a dotenv file. Unknown files are treated as binary files.
+func sopsFormat(file string) string {
+	parts := make([]string, 0)
+	for _, part := range strings.Split(strings.ToLower(filepath.Base(file)), ".") {
+		if part != "enc" && part != "dec" {
+			parts = append(parts, part)
+		}
+	}
+	if len(parts) < 2 {
+		return "binary"
+	}
+
+	// 1) Use the last extension if it is known
+	switch parts[len(parts)-1] {
+	case "yaml", "yml":
+		return "yaml"
+	case "json":
+		return "json"
+	case "ini":
+		return "ini"
+	case "env":
+		return "dotenv"
+	}
+
+	// 2) Dotenv files are often suffixed by their environment (e.g. '.env.production')
+	for _, part := range parts[:len(parts)-1] {
+		if part == "env" {
+			return "dotenv"
+		}
 	}
+	return "binary"
 }
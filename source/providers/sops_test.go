@@ -0,0 +1,164 @@
+package providers
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	filippoage "filippo.io/age"
+	"gotest.tools/assert"
+)
+
+func TestFlattenEnvironment(t *testing.T) {
+	values := map[string]interface{}{
+		"database": map[string]interface{}{"user": "admin", "port": float64(5432)},
+		"hosts":    []interface{}{"a.com", "b.com"},
+		"api-key":  "secret",
+		"debug":    true,
+	}
+
+	result := make(map[string]string)
+	flattenEnvironment("APP_", values, result)
+	assert.DeepEqual(t, result, map[string]string{
+		"APP_DATABASE_USER": "admin",
+		"APP_DATABASE_PORT": "5432",
+		"APP_HOSTS_0":       "a.com",
+		"APP_HOSTS_1":       "b.com",
+		"APP_API_KEY":       "secret",
+		"APP_DEBUG":         "true",
+	})
+}
+
+func TestParseDotenv(t *testing.T) {
+	values, err := parseDotenv([]byte("# comment\n\nUSER=admin\nPASSWORD=a=b\n"))
+	assert.NilError(t, err)
+	assert.DeepEqual(t, values, map[string]string{"USER": "admin", "PASSWORD": "a=b"})
+
+	_, err = parseDotenv([]byte("USER\n"))
+	assert.ErrorContains(t, err, "Invalid line")
+}
+
+func TestSopsFormat(t *testing.T) {
+	formats := map[string]string{
+		"secrets.enc.yaml":       "yaml",
+		"config/secrets.enc.yml": "yaml",
+		"values.json.enc":        "json",
+		"settings.enc.ini":       "ini",
+		"app.enc.env":            "dotenv",
+		".env":                   "dotenv",
+		".env.production":        "dotenv",
+		"app.enc.env.staging":    "dotenv",
+		"certs/tls.enc.key":      "binary",
+		"secrets.enc":            "binary",
+		"environment.enc.txt":    "binary",
+	}
+	for file, format := range formats {
+		assert.Equal(t, sopsFormat(file), format, "Format of '%s' is not detected correctly.", file)
+	}
+}
+
+func TestSopsSetFormat(t *testing.T) {
+	sops := NewSops()
+	assert.NilError(t, sops.SetFormat("dotenv"))
+	assert.Equal(t, sops.fileFormat("secrets.enc.yaml"), "dotenv")
+
+	assert.NilError(t, sops.SetFormat(""))
+	assert.Equal(t, sops.fileFormat("secrets.enc.yaml"), "yaml")
+
+	assert.ErrorContains(t, sops.SetFormat("toml"), "Unknown format")
+}
+
+func TestSopsDecryptAge(t *testing.T) {
+	key, err := ioutil.ReadFile("testdata/age.key")
+	assert.NilError(t, err)
+
+	os.Setenv(sopsAgeKeyEnv, string(key))
+	defer os.Unsetenv(sopsAgeKeyEnv)
+
+	values, err := NewSops().DecryptEnvironment("testdata/secrets.enc.yml", "")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, values, []string{
+		"PASSWORD=correct-horse-battery-staple",
+		"USERNAME=admin",
+	})
+
+	os.Setenv(sopsAgeKeyEnv, "AGE-SECRET-KEY-1INVALID")
+	_, err = NewSops().Decrypt("testdata/secrets.enc.yml")
+	assert.ErrorContains(t, err, "Invalid age key")
+}
+
+func TestSopsEncryptRotateDecrypt(t *testing.T) {
+	const recipient = "age1k85lqktjf6hyy6k8u6yaz4k9p9qxgx6h4rzvr3rfqmvcgttmvgps8w3aqu"
+	key, err := ioutil.ReadFile("testdata/age.key")
+	assert.NilError(t, err)
+	defer os.Unsetenv(sopsAgeKeyEnv)
+
+	identity, err := filippoage.GenerateX25519Identity()
+	assert.NilError(t, err)
+
+	dir, err := ioutil.TempDir("", "cuckoo-sops")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dir)
+
+	configFile := filepath.Join(dir, ".sops.yaml")
+	config := fmt.Sprintf(
+		"creation_rules:\n  - path_regex: \\.enc\\.yml$\n    age: %s\n", recipient,
+	)
+	assert.NilError(t, ioutil.WriteFile(configFile, []byte(config), 0644))
+
+	plain := filepath.Join(dir, "secrets.yml")
+	assert.NilError(t, ioutil.WriteFile(plain, []byte("username: admin\npassword: secret\n"), 0644))
+	encrypted := filepath.Join(dir, "secrets.enc.yml")
+
+	expected := []string{"PASSWORD=secret", "USERNAME=admin"}
+	decrypt := func(key string) ([]string, error) {
+		os.Setenv(sopsAgeKeyEnv, key)
+		return NewSops().DecryptEnvironment(encrypted, "")
+	}
+
+	// 1) Encrypt with the key of the creation rule
+	contents, err := NewSops().Encrypt(plain, encrypted, configFile)
+	assert.NilError(t, err)
+	assert.NilError(t, ioutil.WriteFile(encrypted, contents, 0644))
+
+	values, err := decrypt(string(key))
+	assert.NilError(t, err)
+	assert.DeepEqual(t, values, expected)
+
+	_, err = decrypt(identity.String())
+	assert.Assert(t, err != nil)
+
+	// 2) Rotate to the generated key
+	os.Setenv(sopsAgeKeyEnv, string(key))
+	contents, err = NewSops().Rotate(
+		encrypted,
+		SopsKeys{Age: []string{identity.Recipient().String()}},
+		SopsKeys{Age: []string{recipient}},
+	)
+	assert.NilError(t, err)
+	assert.NilError(t, ioutil.WriteFile(encrypted, contents, 0644))
+
+	values, err = decrypt(identity.String())
+	assert.NilError(t, err)
+	assert.DeepEqual(t, values, expected)
+
+	_, err = decrypt(string(key))
+	assert.Assert(t, err != nil)
+
+	// 3) Update keys to the ones of the creation rule
+	os.Setenv(sopsAgeKeyEnv, identity.String())
+	contents, changed, err := NewSops().UpdateKeys(encrypted, configFile)
+	assert.NilError(t, err)
+	assert.Assert(t, changed)
+	assert.NilError(t, ioutil.WriteFile(encrypted, contents, 0644))
+
+	values, err = decrypt(string(key))
+	assert.NilError(t, err)
+	assert.DeepEqual(t, values, expected)
+
+	_, changed, err = NewSops().UpdateKeys(encrypted, configFile)
+	assert.NilError(t, err)
+	assert.Assert(t, !changed)
+}
@@ -0,0 +1,206 @@
+package storage
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/Azure/azure-storage-blob-go/azblob"
+	"go.borchero.com/typewriter"
+)
+
+type azure struct {
+	container azblob.ContainerURL
+	engine    *transferEngine
+	bucket    string
+	logger    typewriter.CLILogger
+}
+
+// NewAzure configures a new Azure Blob Storage instance for usage where the bucket is the name of
+// a container. The storage account and its access key are read from the environment variables
+// AZURE_STORAGE_ACCOUNT and AZURE_STORAGE_KEY. If no endpoint is given, the account's default
+// endpoint is used.
+func NewAzure(bucket, endpoint string, logger typewriter.CLILogger) (Provider, error) {
+	// 1) Get credentials
+	account := os.Getenv("AZURE_STORAGE_ACCOUNT")
+	key := os.Getenv("AZURE_STORAGE_KEY")
+	if account == "" || key == "" {
+		return nil, fmt.Errorf("AZURE_STORAGE_ACCOUNT and AZURE_STORAGE_KEY must be set")
+	}
+
+	credential, err := azblob.NewSharedKeyCredential(account, key)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid credentials: %s", err)
+	}
+
+	// 2) Get container URL
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://%s.blob.core.windows.net", account)
+	}
+	containerURL, err := url.Parse(fmt.Sprintf("%s/%s", strings.TrimSuffix(endpoint, "/"), bucket))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid endpoint: %s", err)
+	}
+
+	pipeline := azblob.NewPipeline(credential, azblob.PipelineOptions{})
+	return &azure{
+		container: azblob.NewContainerURL(*containerURL, pipeline),
+		engine:    newTransferEngine(logger),
+		bucket:    bucket,
+		logger:    logger,
+	}, nil
+}
+
+func (s *azure) Upload(objects ...TransferObject) error {
+	description := fmt.Sprintf("Uploads to Azure container '%s'", s.bucket)
+	err := s.engine.run(description, len(objects), func(i int) error {
+		return s.uploadObject(objects[i])
+	})
+	if err != nil {
+		return fmt.Errorf("Failed uploading to Azure container '%s': %s", s.bucket, err)
+	}
+	return nil
+}
+
+func (s *azure) Download(bucketPath, localPath string) error {
+	s.logger.Infof(
+		"Downloading from Azure container '%s': %s => %s", s.bucket, bucketPath, localPath,
+	)
+
+	// 1) Get blob
+	ctx := context.Background()
+	response, err := s.container.NewBlobURL(bucketPath).Download(
+		ctx, 0, azblob.CountToEnd, azblob.BlobAccessConditions{}, false,
+		azblob.ClientProvidedKeyOptions{},
+	)
+	if err != nil {
+		serr, ok := err.(azblob.StorageError)
+		if ok && serr.ServiceCode() == azblob.ServiceCodeBlobNotFound {
+			return ErrNotFound
+		}
+		return fmt.Errorf("Failed downloading from Azure container '%s': %s", s.bucket, err)
+	}
+	body := response.Body(azblob.RetryReaderOptions{})
+	defer body.Close()
+
+	// 2) Write to local file
+	if err := writeLocalFile(localPath, body); err != nil {
+		return fmt.Errorf("Failed downloading from Azure container '%s': %s", s.bucket, err)
+	}
+	return nil
+}
+
+func (s *azure) Delete(objects ...string) error {
+	description := fmt.Sprintf("Deletions from Azure container '%s'", s.bucket)
+	err := s.engine.run(description, len(objects), func(i int) error {
+		return s.deleteObject(objects[i])
+	})
+	if err != nil {
+		return fmt.Errorf("Failed deleting from Azure container '%s': %s", s.bucket, err)
+	}
+	return nil
+}
+
+func (s *azure) List(prefix string) ([]ObjectInfo, error) {
+	ctx := context.Background()
+	options := azblob.ListBlobsSegmentOptions{
+		Prefix:  prefix,
+		Details: azblob.BlobListingDetails{Metadata: true},
+	}
+
+	// Iterate over all pages
+	result := make([]ObjectInfo, 0)
+	for marker := (azblob.Marker{}); marker.NotDone(); {
+		response, err := s.container.ListBlobsFlatSegment(ctx, marker, options)
+		if err != nil {
+			return nil, fmt.Errorf("Failed listing objects: %s", err)
+		}
+
+		for _, blob := range response.Segment.BlobItems {
+			info := ObjectInfo{
+				Path:       blob.Name,
+				ETag:       string(blob.Properties.Etag),
+				Attributes: metadataAttributes(blob.Metadata),
+			}
+			if blob.Properties.ContentLength != nil {
+				info.Size = *blob.Properties.ContentLength
+			}
+			if len(blob.Properties.ContentMD5) > 0 {
+				info.MD5 = hex.EncodeToString(blob.Properties.ContentMD5)
+			}
+			result = append(result, info)
+		}
+		marker = response.NextMarker
+	}
+
+	return result, nil
+}
+
+func (s *azure) uploadObject(object TransferObject) error {
+	s.logger.Infof(
+		"Uploading to Azure container '%s': %s => %s",
+		s.bucket, object.LocalPath, object.BucketPath,
+	)
+
+	// 1) Open local file
+	file, err := os.Open(object.LocalPath)
+	if err != nil {
+		return fmt.Errorf("Failed opening local file '%s': %s", object.LocalPath, err)
+	}
+	defer file.Close()
+
+	// 2) Get headers
+	// 2.1) Get MD5 checksum (it is not computed by Azure for blobs uploaded in blocks)
+	info, err := LocalObjectInfo(object.LocalPath)
+	if err != nil {
+		return err
+	}
+	checksum, err := hex.DecodeString(info.MD5)
+	if err != nil {
+		return err
+	}
+
+	// 2.2) Get Mime
+	mimeType, err := objectMimeType(object, file)
+	if err != nil {
+		return fmt.Errorf("Failed getting mime type of local file '%s': %s", object.LocalPath, err)
+	}
+
+	// 3) Upload (in blocks if the file is large)
+	options := azblob.UploadToBlockBlobOptions{
+		BlockSize: multipartPartSize,
+		BlobHTTPHeaders: azblob.BlobHTTPHeaders{
+			ContentType:        mimeType,
+			ContentMD5:         checksum,
+			ContentEncoding:    object.ContentEncoding,
+			ContentDisposition: object.ContentDisposition,
+			CacheControl:       object.CacheControl,
+		},
+		Metadata: uploadMetadata(object),
+	}
+
+	ctx := context.Background()
+	blob := s.container.NewBlockBlobURL(object.BucketPath)
+	if _, err := azblob.UploadFileToBlockBlob(ctx, file, blob, options); err != nil {
+		return fmt.Errorf("Failed uploading file to path '%s': %s", object.BucketPath, err)
+	}
+
+	return nil
+}
+
+func (s *azure) deleteObject(object string) error {
+	s.logger.Infof("Deleting from Azure container '%s': %s", s.bucket, object)
+
+	ctx := context.Background()
+	_, err := s.container.NewBlobURL(object).Delete(
+		ctx, azblob.DeleteSnapshotsOptionInclude, azblob.BlobAccessConditions{},
+	)
+	if err != nil {
+		return fmt.Errorf("Failed deleting file at path '%s': %s", object, err)
+	}
+
+	return nil
+}
@@ -2,6 +2,7 @@ package storage
 
 import (
 	"context"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"os"
@@ -14,6 +15,7 @@ import (
 
 type gcs struct {
 	client *gcloud.Client
+	engine *transferEngine
 	bucket string
 	logger typewriter.CLILogger
 }
@@ -27,37 +29,63 @@ func NewGCS(ctx context.Context, bucket string, logger typewriter.CLILogger) (Pr
 
 	return &gcs{
 		client: client,
+		engine: newTransferEngine(logger),
 		bucket: bucket,
 		logger: logger,
 	}, nil
 }
 
 func (s *gcs) Upload(objects ...TransferObject) error {
-	for _, object := range objects {
-		if err := s.uploadObject(object); err != nil {
-			return fmt.Errorf("Failed uploading to GCS bucket '%s': %s", s.bucket, err)
+	description := fmt.Sprintf("Uploads to GCS bucket '%s'", s.bucket)
+	err := s.engine.run(description, len(objects), func(i int) error {
+		return s.uploadObject(objects[i])
+	})
+	if err != nil {
+		return fmt.Errorf("Failed uploading to GCS bucket '%s': %s", s.bucket, err)
+	}
+	return nil
+}
+
+func (s *gcs) Download(bucketPath, localPath string) error {
+	s.logger.Infof("Downloading from GCS bucket '%s': %s => %s", s.bucket, bucketPath, localPath)
+
+	// 1) Get reader from bucket
+	ctx := context.Background()
+	reader, err := s.client.Bucket(s.bucket).Object(bucketPath).NewReader(ctx)
+	if err != nil {
+		if err == gcloud.ErrObjectNotExist {
+			return ErrNotFound
 		}
+		return fmt.Errorf("Failed downloading from GCS bucket '%s': %s", s.bucket, err)
+	}
+	defer reader.Close()
+
+	// 2) Write to local file
+	if err := writeLocalFile(localPath, reader); err != nil {
+		return fmt.Errorf("Failed downloading from GCS bucket '%s': %s", s.bucket, err)
 	}
 	return nil
 }
 
 func (s *gcs) Delete(objects ...string) error {
-	for _, object := range objects {
-		if err := s.deleteObject(object); err != nil {
-			return fmt.Errorf("Failed deleting from GCS bucket '%s': %s", s.bucket, err)
-		}
+	description := fmt.Sprintf("Deletions from GCS bucket '%s'", s.bucket)
+	err := s.engine.run(description, len(objects), func(i int) error {
+		return s.deleteObject(objects[i])
+	})
+	if err != nil {
+		return fmt.Errorf("Failed deleting from GCS bucket '%s': %s", s.bucket, err)
 	}
 	return nil
 }
 
-func (s *gcs) List() ([]string, error) {
-	// 1) Make request
+func (s *gcs) List(prefix string) ([]ObjectInfo, error) {
+	// 1) Make request (the iterator fetches further pages when required)
 	ctx := context.Background()
-	query := &gcloud.Query{Versions: false}
+	query := &gcloud.Query{Prefix: prefix, Versions: false}
 	it := s.client.Bucket(s.bucket).Objects(ctx, query)
 
 	// 2) Get all objects
-	result := make([]string, 0)
+	result := make([]ObjectInfo, 0)
 	for {
 		attributes, err := it.Next()
 		if err != nil {
@@ -66,12 +94,46 @@ func (s *gcs) List() ([]string, error) {
 			}
 			return nil, fmt.Errorf("Failed listing objects: %s", err)
 		}
-		result = append(result, attributes.Name)
+		result = append(result, gcsObjectInfo(attributes))
 	}
 
 	return result, nil
 }
 
+func (s *gcs) Website() (WebsiteConfig, error) {
+	ctx := context.Background()
+	attributes, err := s.client.Bucket(s.bucket).Attrs(ctx)
+	if err != nil {
+		return WebsiteConfig{}, fmt.Errorf(
+			"Failed getting website configuration of GCS bucket '%s': %s", s.bucket, err,
+		)
+	}
+
+	if attributes.Website == nil {
+		return WebsiteConfig{}, nil
+	}
+	return WebsiteConfig{
+		IndexDocument: attributes.Website.MainPageSuffix,
+		ErrorDocument: attributes.Website.NotFoundPage,
+	}, nil
+}
+
+func (s *gcs) ConfigureWebsite(config WebsiteConfig) error {
+	s.logger.Infof("Configuring website of GCS bucket '%s'", s.bucket)
+
+	ctx := context.Background()
+	_, err := s.client.Bucket(s.bucket).Update(ctx, gcloud.BucketAttrsToUpdate{
+		Website: &gcloud.BucketWebsite{
+			MainPageSuffix: config.IndexDocument,
+			NotFoundPage:   config.ErrorDocument,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("Failed configuring website of GCS bucket '%s': %s", s.bucket, err)
+	}
+	return nil
+}
+
 func (s *gcs) uploadObject(object TransferObject) error {
 	s.logger.Infof(
 		"Uploading to GCS bucket '%s': %s => %s",
@@ -85,14 +147,31 @@ func (s *gcs) uploadObject(object TransferObject) error {
 	}
 	defer file.Close()
 
+	stat, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("Failed reading local file '%s': %s", object.LocalPath, err)
+	}
+
 	// 2) Get writer to bucket
-	// 2.1) Get context (30 second write timeout)
+	// 2.1) Get context (30 second write timeout per chunk)
+	chunks := stat.Size()/multipartPartSize + 1
 	ctx := context.Background()
-	ctx, cancel := context.WithTimeout(ctx, time.Second*30)
+	ctx, cancel := context.WithTimeout(ctx, time.Second*30*time.Duration(chunks))
 	defer cancel()
 
-	// 2.2) Get bucket writer
+	// 2.2) Get bucket writer (large files are uploaded in chunks)
+	mimeType, err := objectMimeType(object, file)
+	if err != nil {
+		return fmt.Errorf("Failed getting mime type of local file '%s': %s", object.LocalPath, err)
+	}
+
 	writer := s.client.Bucket(s.bucket).Object(object.BucketPath).NewWriter(ctx)
+	writer.ChunkSize = multipartPartSize
+	writer.ContentType = mimeType
+	writer.CacheControl = object.CacheControl
+	writer.ContentDisposition = object.ContentDisposition
+	writer.ContentEncoding = object.ContentEncoding
+	writer.Metadata = uploadMetadata(object)
 	if _, err := io.Copy(writer, file); err != nil {
 		return fmt.Errorf("Failed uploading file to path '%s': %s", object.BucketPath, err)
 	}
@@ -106,7 +185,7 @@ func (s *gcs) uploadObject(object TransferObject) error {
 }
 
 func (s *gcs) deleteObject(object string) error {
-	s.logger.Infof("Deleting from S3 bucket '%s': %s", s.bucket, object)
+	s.logger.Infof("Deleting from GCS bucket '%s': %s", s.bucket, object)
 
 	ctx := context.Background()
 	if err := s.client.Bucket(s.bucket).Object(object).Delete(ctx); err != nil {
@@ -115,3 +194,19 @@ func (s *gcs) deleteObject(object string) error {
 
 	return nil
 }
+
+// gcsObjectInfo returns the metadata of the given object. Composite objects do not have an MD5
+// checksum.
+func gcsObjectInfo(attributes *gcloud.ObjectAttrs) ObjectInfo {
+	info := ObjectInfo{
+		Path:       attributes.Name,
+		Size:       attributes.Size,
+		ETag:       attributes.Etag,
+		CRC32C:     fmt.Sprintf("%08x", attributes.CRC32C),
+		Attributes: metadataAttributes(attributes.Metadata),
+	}
+	if len(attributes.MD5) > 0 {
+		info.MD5 = hex.EncodeToString(attributes.MD5)
+	}
+	return info
+}
@@ -1,9 +1,34 @@
 package storage
 
-// TransferObject describes the local path and the storage path of an item.
+import "errors"
+
+// ErrNotFound is returned when an object to be downloaded does not exist in the bucket.
+var ErrNotFound = errors.New("Object does not exist")
+
+// TransferObject describes the local path and the storage path of an item. Optionally, it
+// describes attributes of the uploaded object, empty attributes are not set. If no content type is
+// given, it is detected from the local file. Website redirects are only supported by S3.
 type TransferObject struct {
-	LocalPath  string
-	BucketPath string
+	LocalPath          string
+	BucketPath         string
+	CacheControl       string
+	ContentType        string
+	ContentDisposition string
+	ContentEncoding    string
+	Metadata           map[string]string
+	WebsiteRedirect    string
+}
+
+// ObjectInfo describes an object in the bucket or a local file. Checksums are hex-encoded and
+// empty if unknown. Attributes is the hash of the attributes the object was uploaded with (see
+// TransferObject.AttributesHash), it is empty if the object was uploaded without attributes.
+type ObjectInfo struct {
+	Path       string
+	Size       int64
+	MD5        string
+	ETag       string
+	CRC32C     string
+	Attributes string
 }
 
 // Provider is an interface that enables accessing object storage buckets of different cloud
@@ -14,10 +39,22 @@ type Provider interface {
 	// returns an error if the upload of at least one object fails.
 	Upload(objects ...TransferObject) error
 
+	// Download downloads the object at the given bucket path to the given local path and returns
+	// ErrNotFound if the object does not exist.
+	Download(bucketPath, localPath string) error
+
 	// Delete deletes the objects at the specified paths and returns an error if removal fails.
 	Delete(objects ...string) error
 
-	// List lists the objects in the bucket (recursively) and returns an error if listing fails for
-	// some reason.
-	List() ([]string, error)
+	// List lists all objects in the bucket whose paths start with the given prefix (recursively)
+	// along with their metadata and returns an error if listing fails for some reason.
+	List(prefix string) ([]ObjectInfo, error)
+}
+
+// AttributesProvider is implemented by providers which do not list the attributes of objects.
+type AttributesProvider interface {
+
+	// Attributes returns the hashes of the attributes of the objects at the given paths, keyed by
+	// path. Objects which do not exist are omitted.
+	Attributes(paths ...string) (map[string]string, error)
 }
@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.borchero.com/cuckoo/utils"
+	"go.borchero.com/typewriter"
+)
+
+type local struct {
+	dir    string
+	logger typewriter.CLILogger
+}
+
+// NewLocal configures a new provider which stores objects as files in the given directory. The
+// directory is created if it does not exist. Attributes of objects such as their content type are
+// not stored.
+func NewLocal(dir string, logger typewriter.CLILogger) (Provider, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("Failed creating directory '%s': %s", dir, err)
+	}
+	return &local{dir: dir, logger: logger}, nil
+}
+
+func (s *local) Upload(objects ...TransferObject) error {
+	for _, object := range objects {
+		s.logger.Infof(
+			"Copying to directory '%s': %s => %s", s.dir, object.LocalPath, object.BucketPath,
+		)
+
+		target := s.path(object.BucketPath)
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return fmt.Errorf("Failed creating directory for '%s': %s", object.BucketPath, err)
+		}
+		if err := utils.CopyFile(object.LocalPath, target); err != nil {
+			return fmt.Errorf("Failed copying to path '%s': %s", object.BucketPath, err)
+		}
+	}
+	return nil
+}
+
+func (s *local) Download(bucketPath, localPath string) error {
+	s.logger.Infof("Copying from directory '%s': %s => %s", s.dir, bucketPath, localPath)
+
+	err := utils.CopyFile(s.path(bucketPath), localPath)
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (s *local) Delete(objects ...string) error {
+	for _, object := range objects {
+		s.logger.Infof("Deleting from directory '%s': %s", s.dir, object)
+		if err := os.Remove(s.path(object)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("Failed deleting file at path '%s': %s", object, err)
+		}
+	}
+	return nil
+}
+
+func (s *local) List(prefix string) ([]ObjectInfo, error) {
+	files, err := utils.GetMatchingFiles(".*", s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("Failed listing objects: %s", err)
+	}
+
+	result := make([]ObjectInfo, 0)
+	for _, file := range files {
+		relPath, err := filepath.Rel(s.dir, file)
+		if err != nil {
+			return nil, err
+		}
+		objectPath := filepath.ToSlash(relPath)
+		if !strings.HasPrefix(objectPath, prefix) {
+			continue
+		}
+
+		info, err := LocalObjectInfo(file)
+		if err != nil {
+			return nil, err
+		}
+		info.Path = objectPath
+		result = append(result, info)
+	}
+	return result, nil
+}
+
+func (s *local) path(object string) string {
+	return filepath.Join(s.dir, filepath.FromSlash(object))
+}
@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"bytes"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// MemoryObject describes an object stored by a memory provider along with the attributes it was
+// uploaded with.
+type MemoryObject struct {
+	Contents   []byte
+	Attributes TransferObject
+}
+
+// Memory is a provider which stores objects in memory. It is intended for testing.
+type Memory struct {
+	objects map[string]MemoryObject
+	website WebsiteConfig
+	mutex   sync.Mutex
+}
+
+// NewMemory returns a new empty memory provider.
+func NewMemory() *Memory {
+	return &Memory{objects: make(map[string]MemoryObject)}
+}
+
+// Object returns the object at the given path, if it exists.
+func (s *Memory) Object(path string) (MemoryObject, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	object, ok := s.objects[path]
+	return object, ok
+}
+
+// Website returns the website configuration which was set last.
+func (s *Memory) Website() (WebsiteConfig, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.website, nil
+}
+
+// Upload stores the contents of the given objects.
+func (s *Memory) Upload(objects ...TransferObject) error {
+	for _, object := range objects {
+		contents, err := ioutil.ReadFile(object.LocalPath)
+		if err != nil {
+			return err
+		}
+
+		s.mutex.Lock()
+		s.objects[object.BucketPath] = MemoryObject{Contents: contents, Attributes: object}
+		s.mutex.Unlock()
+	}
+	return nil
+}
+
+// Download writes the contents of the object at the given path to the given local path.
+func (s *Memory) Download(bucketPath, localPath string) error {
+	object, ok := s.Object(bucketPath)
+	if !ok {
+		return ErrNotFound
+	}
+	return writeLocalFile(localPath, bytes.NewReader(object.Contents))
+}
+
+// Delete removes the objects at the given paths.
+func (s *Memory) Delete(objects ...string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, object := range objects {
+		delete(s.objects, object)
+	}
+	return nil
+}
+
+// List returns all objects whose paths start with the given prefix, sorted by their paths.
+func (s *Memory) List(prefix string) ([]ObjectInfo, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	result := make([]ObjectInfo, 0)
+	for path, object := range s.objects {
+		if !strings.HasPrefix(path, prefix) {
+			continue
+		}
+		info, err := readObjectInfo(path, bytes.NewReader(object.Contents))
+		if err != nil {
+			return nil, err
+		}
+		info.Attributes = object.Attributes.AttributesHash()
+		result = append(result, info)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Path < result[j].Path
+	})
+	return result, nil
+}
+
+// ConfigureWebsite stores the website configuration.
+func (s *Memory) ConfigureWebsite(config WebsiteConfig) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.website = config
+	return nil
+}
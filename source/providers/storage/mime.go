@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const defaultMimeType = "application/octet-stream"
+
+var (
+	// mimeTypes maps lowercase file extensions to content types. Go's mime package is not used as
+	// its types depend on the configuration of the system.
+	mimeTypes = map[string]string{
+		// Documents
+		".html":        "text/html; charset=utf-8",
+		".htm":         "text/html; charset=utf-8",
+		".css":         "text/css; charset=utf-8",
+		".js":          "text/javascript; charset=utf-8",
+		".mjs":         "text/javascript; charset=utf-8",
+		".cjs":         "text/javascript; charset=utf-8",
+		".json":        "application/json",
+		".map":         "application/json",
+		".jsonld":      "application/ld+json",
+		".webmanifest": "application/manifest+json",
+		".xml":         "application/xml",
+		".rss":         "application/rss+xml",
+		".atom":        "application/atom+xml",
+		".txt":         "text/plain; charset=utf-8",
+		".md":          "text/markdown; charset=utf-8",
+		".csv":         "text/csv; charset=utf-8",
+		".yaml":        "application/yaml",
+		".yml":         "application/yaml",
+		".pdf":         "application/pdf",
+		".wasm":        "application/wasm",
+		// Images
+		".svg":  "image/svg+xml",
+		".png":  "image/png",
+		".jpg":  "image/jpeg",
+		".jpeg": "image/jpeg",
+		".gif":  "image/gif",
+		".webp": "image/webp",
+		".avif": "image/avif",
+		".ico":  "image/x-icon",
+		".bmp":  "image/bmp",
+		// Fonts
+		".woff":  "font/woff",
+		".woff2": "font/woff2",
+		".ttf":   "font/ttf",
+		".otf":   "font/otf",
+		".eot":   "application/vnd.ms-fontobject",
+		// Media
+		".mp4":  "video/mp4",
+		".webm": "video/webm",
+		".mp3":  "audio/mpeg",
+		".ogg":  "audio/ogg",
+		".wav":  "audio/wav",
+		// Archives
+		".zip": "application/zip",
+		".gz":  "application/gzip",
+		".tgz": "application/gzip",
+		".tar": "application/x-tar",
+	}
+	mimeTypesLock sync.RWMutex
+)
+
+// SetMimeType sets the content type of all files with the given extension (e.g. '.html'),
+// overriding the default content type of the extension.
+func SetMimeType(extension, mimeType string) error {
+	if !strings.HasPrefix(extension, ".") || mimeType == "" {
+		return fmt.Errorf("Invalid content type '%s' for extension '%s'", mimeType, extension)
+	}
+
+	mimeTypesLock.Lock()
+	defer mimeTypesLock.Unlock()
+	mimeTypes[strings.ToLower(extension)] = mimeType
+	return nil
+}
+
+// objectMimeType returns the content type of the given object. Unless set explicitly, it is
+// detected from the local file. The contents of compressed files are not inspected.
+func objectMimeType(object TransferObject, file *os.File) (string, error) {
+	if object.ContentType != "" {
+		return object.ContentType, nil
+	}
+	if object.ContentEncoding != "" {
+		return getMimeType(object.LocalPath, nil)
+	}
+	return getMimeType(object.LocalPath, file)
+}
+
+// getMimeType returns the content type of the file with the given name. If the file's extension is
+// unknown, the content type is detected from the file's contents (if given).
+func getMimeType(filename string, file *os.File) (string, error) {
+	// 1) Check if mime type can be determined from filename
+	mimeTypesLock.RLock()
+	mimeType, ok := mimeTypes[strings.ToLower(filepath.Ext(filename))]
+	mimeTypesLock.RUnlock()
+	if ok {
+		return mimeType, nil
+	}
+
+	// 2) Otherwise, detect content type
+	if file == nil {
+		return defaultMimeType, nil
+	}
+
+	head := make([]byte, 512)
+	n, err := file.Read(head)
+	if err != nil && err != io.EOF {
+		return "", fmt.Errorf("Failed to read head of file: %s", err)
+	}
+	if _, err := file.Seek(0, 0); err != nil {
+		return "", fmt.Errorf("Failed to seek to beginning of file: %s", err)
+	}
+	if n == 0 {
+		return defaultMimeType, nil
+	}
+	return http.DetectContentType(head[:n]), nil
+}
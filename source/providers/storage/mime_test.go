@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestGetMimeType(t *testing.T) {
+	types := map[string]string{
+		"index.html":         "text/html; charset=utf-8",
+		"assets/app.mjs":     "text/javascript; charset=utf-8",
+		"logo.SVG":           "image/svg+xml",
+		"data.json":          "application/json",
+		"app.wasm":           "application/wasm",
+		"fonts/inter.woff2":  "font/woff2",
+		"site.webmanifest":   "application/manifest+json",
+		"download.unknown":   defaultMimeType,
+		"charts/index.yaml":  "application/yaml",
+		"charts/app-1.0.tgz": "application/gzip",
+	}
+	for file, expected := range types {
+		mimeType, err := getMimeType(file, nil)
+		assert.NilError(t, err)
+		assert.Equal(t, mimeType, expected, "Type of '%s' is not detected correctly.", file)
+	}
+}
+
+func TestGetMimeTypeSniffing(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cuckoo-mime-*")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dir)
+
+	sniff := func(name, contents string) string {
+		path := filepath.Join(dir, name)
+		assert.NilError(t, ioutil.WriteFile(path, []byte(contents), 0644))
+
+		file, err := os.Open(path)
+		assert.NilError(t, err)
+		defer file.Close()
+
+		mimeType, err := getMimeType(path, file)
+		assert.NilError(t, err)
+		return mimeType
+	}
+
+	assert.Equal(t, sniff("empty", ""), defaultMimeType)
+	assert.Equal(t, sniff("LICENSE", "MIT License"), "text/plain; charset=utf-8")
+	assert.Equal(t, sniff("page", "<!DOCTYPE html><html></html>"), "text/html; charset=utf-8")
+}
+
+func TestSetMimeType(t *testing.T) {
+	assert.NilError(t, SetMimeType(".Foo", "application/x-foo"))
+	defer delete(mimeTypes, ".foo")
+
+	mimeType, err := getMimeType("file.foo", nil)
+	assert.NilError(t, err)
+	assert.Equal(t, mimeType, "application/x-foo")
+
+	assert.ErrorContains(t, SetMimeType("foo", "application/x-foo"), "Invalid content type")
+}
@@ -0,0 +1,173 @@
+package storage
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"go.borchero.com/cuckoo/utils"
+	"go.borchero.com/typewriter"
+)
+
+// PublishOptions describes how a local directory is published to a bucket.
+type PublishOptions struct {
+	// Dir is the directory whose files are published.
+	Dir string
+	// Prefix is prepended to the paths of all files within the directory. A slash is appended if
+	// it does not end with one (see NormalizePrefix).
+	Prefix string
+	// Rules are applied to all files, if given.
+	Rules *PublishRulesFile
+	// Website describes redirects which are published along with the files, if given. The
+	// bucket's website configuration is not changed (see ConfigureWebsite).
+	Website *WebsiteFile
+	// Force indicates whether unchanged files are uploaded as well.
+	Force bool
+	// Purge indicates whether objects with the prefix which do not exist locally are removed.
+	Purge bool
+}
+
+// Publish uploads all files of the directory given by the options to the bucket and returns the
+// changes that were made.
+func Publish(
+	provider Provider, options PublishOptions, logger typewriter.CLILogger,
+) (SyncPlan, error) {
+	// 1) Get objects to upload
+	// 1.1) Iterate over directory
+	options.Prefix = NormalizePrefix(options.Prefix)
+	dir := filepath.Clean(options.Dir)
+	files, err := utils.GetMatchingFiles(".*", dir)
+	if err != nil {
+		return SyncPlan{}, fmt.Errorf("Unable to get files of directory: %s", err)
+	}
+
+	// 1.2) Prepare directory for compressed files and redirects
+	tempDir, err := ioutil.TempDir("", "cuckoo-publish-*")
+	if err != nil {
+		return SyncPlan{}, fmt.Errorf("Unable to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// 1.3) Get transfer objects
+	rules := options.Rules
+	if rules == nil {
+		rules = &PublishRulesFile{}
+	}
+
+	transfer := make([]TransferObject, len(files))
+	for i, file := range files {
+		relPath, err := filepath.Rel(dir, filepath.Clean(file))
+		if err != nil {
+			return SyncPlan{}, err
+		}
+		transfer[i] = TransferObject{
+			LocalPath:  file,
+			BucketPath: options.Prefix + filepath.ToSlash(relPath),
+		}
+
+		// 1.4) Apply rules, compressing the file if requested
+		if compression := rules.Apply(relPath, &transfer[i]); compression != "" {
+			compressed := filepath.Join(tempDir, "compressed", relPath)
+			if err := CompressFile(file, compressed, compression); err != nil {
+				return SyncPlan{}, err
+			}
+			transfer[i].LocalPath = compressed
+			transfer[i].ContentEncoding = compression
+		}
+	}
+
+	// 1.5) Add redirects
+	if options.Website != nil {
+		redirects, err := options.Website.redirectObjects(tempDir, options.Prefix)
+		if err != nil {
+			return SyncPlan{}, err
+		}
+		paths := make(map[string]bool)
+		for _, object := range transfer {
+			paths[object.BucketPath] = true
+		}
+		for _, redirect := range redirects {
+			if paths[redirect.BucketPath] {
+				return SyncPlan{}, fmt.Errorf(
+					"Redirect from '%s' conflicts with a published file", redirect.BucketPath,
+				)
+			}
+			paths[redirect.BucketPath] = true
+		}
+		transfer = append(transfer, redirects...)
+	}
+
+	// 2) Compare with existing objects
+	// 2.1) List existing objects
+	existing, err := provider.List(options.Prefix)
+	if err != nil {
+		return SyncPlan{}, fmt.Errorf("Unable to list existing objects: %s", err)
+	}
+
+	// 2.2) Get attributes of objects with unchanged contents if they are not listed
+	if attributes, ok := provider.(AttributesProvider); ok && !options.Force {
+		if err := loadAttributes(attributes, transfer, existing); err != nil {
+			return SyncPlan{}, fmt.Errorf("Unable to get attributes of existing objects: %s", err)
+		}
+	}
+
+	plan, err := PlanSync(transfer, existing, options.Force, options.Purge)
+	if err != nil {
+		return SyncPlan{}, fmt.Errorf("Unable to compare files with existing objects: %s", err)
+	}
+
+	// 3) Upload changed objects
+	if err := provider.Upload(plan.Upload...); err != nil {
+		return plan, err
+	}
+
+	// 4) Purge removed objects if needed
+	if err := provider.Delete(plan.Delete...); err != nil {
+		return plan, err
+	}
+
+	logger.Infof(
+		"Uploaded %d, deleted %d, %d unchanged",
+		len(plan.Upload), len(plan.Delete), plan.Unchanged,
+	)
+	return plan, nil
+}
+
+// loadAttributes sets the attributes of all existing objects which are published again with
+// unchanged contents. Attributes of other objects are irrelevant as they are uploaded anyway.
+func loadAttributes(
+	provider AttributesProvider, transfer []TransferObject, existing []ObjectInfo,
+) error {
+	published := make(map[string]TransferObject)
+	for _, object := range transfer {
+		published[object.BucketPath] = object
+	}
+
+	paths := make([]string, 0)
+	for _, object := range existing {
+		transferObject, ok := published[object.Path]
+		if !ok {
+			continue
+		}
+		local, err := LocalObjectInfo(transferObject.LocalPath)
+		if err != nil {
+			return err
+		}
+		if local.Matches(object) {
+			paths = append(paths, object.Path)
+		}
+	}
+	if len(paths) == 0 {
+		return nil
+	}
+
+	hashes, err := provider.Attributes(paths...)
+	if err != nil {
+		return err
+	}
+	for i := range existing {
+		existing[i].Attributes = hashes[existing[i].Path]
+	}
+	return nil
+}
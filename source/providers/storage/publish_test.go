@@ -0,0 +1,208 @@
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.borchero.com/typewriter"
+	"gotest.tools/assert"
+)
+
+func TestPublish(t *testing.T) {
+	dir := writeSite(t, map[string]string{
+		"index.html":    "<html></html>",
+		"assets/app.js": "console.log('cuckoo')",
+	})
+	defer os.RemoveAll(dir)
+
+	provider := NewMemory()
+	logger := typewriter.NewCLILogger()
+
+	// Objects outside of the prefix must never be touched
+	provider.objects["other/index.html"] = MemoryObject{Contents: []byte("other")}
+	provider.objects["site/removed.html"] = MemoryObject{Contents: []byte("removed")}
+
+	// 1) Initial upload
+	options := PublishOptions{Dir: dir, Prefix: "site/"}
+	plan, err := Publish(provider, options, logger)
+	assert.NilError(t, err)
+	assert.Equal(t, len(plan.Upload), 2)
+	assert.Equal(t, len(plan.Delete), 0)
+
+	object, ok := provider.Object("site/assets/app.js")
+	assert.Assert(t, ok, "Object was not uploaded.")
+	assert.Equal(t, string(object.Contents), "console.log('cuckoo')")
+	_, ok = provider.Object("site/removed.html")
+	assert.Assert(t, ok, "Object was removed without purging.")
+
+	// 2) Unchanged upload with purge
+	options.Purge = true
+	plan, err = Publish(provider, options, logger)
+	assert.NilError(t, err)
+	assert.Equal(t, len(plan.Upload), 0)
+	assert.Equal(t, plan.Unchanged, 2)
+	assert.DeepEqual(t, plan.Delete, []string{"site/removed.html"})
+
+	_, ok = provider.Object("site/removed.html")
+	assert.Assert(t, !ok, "Object was not purged.")
+	_, ok = provider.Object("other/index.html")
+	assert.Assert(t, ok, "Object outside of prefix was purged.")
+
+	// 3) Changed file with rules
+	path := filepath.Join(dir, "index.html")
+	assert.NilError(t, ioutil.WriteFile(path, []byte("<html>changed</html>"), 0644))
+	options.Rules = &PublishRulesFile{Rules: []PublishRule{
+		{Match: "*.html", CacheControl: "no-cache", pattern: globPattern("*.html")},
+	}}
+
+	plan, err = Publish(provider, options, logger)
+	assert.NilError(t, err)
+	assert.Equal(t, len(plan.Upload), 1)
+	object, _ = provider.Object("site/index.html")
+	assert.Equal(t, string(object.Contents), "<html>changed</html>")
+	assert.Equal(t, object.Attributes.CacheControl, "no-cache")
+
+	// 4) Unchanged file with changed rules
+	options.Rules.Rules[0].CacheControl = "max-age=60"
+	plan, err = Publish(provider, options, logger)
+	assert.NilError(t, err)
+	assert.Equal(t, len(plan.Upload), 1)
+	assert.Equal(t, plan.Upload[0].BucketPath, "site/index.html")
+	object, _ = provider.Object("site/index.html")
+	assert.Equal(t, object.Attributes.CacheControl, "max-age=60")
+
+	plan, err = Publish(provider, options, logger)
+	assert.NilError(t, err)
+	assert.Equal(t, len(plan.Upload), 0)
+}
+
+func TestPublishPrefixWithoutSlash(t *testing.T) {
+	dir := writeSite(t, map[string]string{"index.html": "index"})
+	defer os.RemoveAll(dir)
+
+	provider := NewMemory()
+	for _, path := range []string{"docs/removed.html", "docs-old/index.html", "docsfoo.html"} {
+		provider.objects[path] = MemoryObject{Contents: []byte("other")}
+	}
+
+	options := PublishOptions{Dir: dir, Prefix: "docs", Purge: true}
+	plan, err := Publish(provider, options, typewriter.NewCLILogger())
+	assert.NilError(t, err)
+	assert.DeepEqual(t, plan.Delete, []string{"docs/removed.html"})
+
+	_, ok := provider.Object("docs/index.html")
+	assert.Assert(t, ok, "Object was not uploaded to the prefix directory.")
+	for _, path := range []string{"docs-old/index.html", "docsfoo.html"} {
+		_, ok := provider.Object(path)
+		assert.Assert(t, ok, "Sibling object of prefix was purged.")
+	}
+}
+
+// unlistedAttributes is a memory provider which does not list the attributes of objects, like S3.
+type unlistedAttributes struct {
+	*Memory
+	requested []string
+}
+
+func (s *unlistedAttributes) List(prefix string) ([]ObjectInfo, error) {
+	objects, err := s.Memory.List(prefix)
+	for i := range objects {
+		objects[i].Attributes = ""
+	}
+	return objects, err
+}
+
+func (s *unlistedAttributes) Attributes(paths ...string) (map[string]string, error) {
+	s.requested = append(s.requested, paths...)
+	result := make(map[string]string)
+	for _, path := range paths {
+		if object, ok := s.Object(path); ok {
+			result[path] = object.Attributes.AttributesHash()
+		}
+	}
+	return result, nil
+}
+
+func TestPublishUnlistedAttributes(t *testing.T) {
+	dir := writeSite(t, map[string]string{"index.html": "index", "app.js": "app"})
+	defer os.RemoveAll(dir)
+
+	provider := &unlistedAttributes{Memory: NewMemory()}
+	provider.objects["site/index.html"] = MemoryObject{Contents: []byte("outdated")}
+	provider.objects["site/other.html"] = MemoryObject{Contents: []byte("other")}
+	logger := typewriter.NewCLILogger()
+
+	rules := &PublishRulesFile{Rules: []PublishRule{
+		{Match: "*.html", CacheControl: "no-cache", pattern: globPattern("*.html")},
+	}}
+	options := PublishOptions{Dir: dir, Prefix: "site/", Rules: rules}
+	_, err := Publish(provider, options, logger)
+	assert.NilError(t, err)
+
+	// Attributes are only requested for existing objects which are published again with unchanged
+	// contents
+	assert.Equal(t, len(provider.requested), 0)
+
+	provider.requested = nil
+	plan, err := Publish(provider, options, logger)
+	assert.NilError(t, err)
+	assert.Equal(t, len(plan.Upload), 0)
+	assert.Equal(t, plan.Unchanged, 2)
+	assert.DeepEqual(t, provider.requested, []string{"site/app.js", "site/index.html"})
+
+	rules.Rules[0].CacheControl = "max-age=60"
+	plan, err = Publish(provider, options, logger)
+	assert.NilError(t, err)
+	assert.Equal(t, len(plan.Upload), 1)
+	assert.Equal(t, plan.Upload[0].BucketPath, "site/index.html")
+}
+
+func TestPublishLocal(t *testing.T) {
+	dir := writeSite(t, map[string]string{"index.html": "index", "docs/page.html": "page"})
+	defer os.RemoveAll(dir)
+
+	bucket, err := ioutil.TempDir("", "cuckoo-bucket-*")
+	assert.NilError(t, err)
+	defer os.RemoveAll(bucket)
+
+	provider, err := NewLocal(bucket, typewriter.NewCLILogger())
+	assert.NilError(t, err)
+
+	options := PublishOptions{Dir: dir, Prefix: "v1/", Purge: true}
+	_, err = Publish(provider, options, typewriter.NewCLILogger())
+	assert.NilError(t, err)
+
+	contents, err := ioutil.ReadFile(filepath.Join(bucket, "v1", "docs", "page.html"))
+	assert.NilError(t, err)
+	assert.Equal(t, string(contents), "page")
+
+	// Removing a local file removes the object
+	assert.NilError(t, os.Remove(filepath.Join(dir, "docs", "page.html")))
+	plan, err := Publish(provider, options, typewriter.NewCLILogger())
+	assert.NilError(t, err)
+	assert.DeepEqual(t, plan.Delete, []string{"v1/docs/page.html"})
+	assert.Equal(t, plan.Unchanged, 1)
+
+	objects, err := provider.List("")
+	assert.NilError(t, err)
+	assert.Equal(t, len(objects), 1)
+	assert.Equal(t, objects[0].Path, "v1/index.html")
+
+	target := filepath.Join(dir, "download")
+	assert.Equal(t, provider.Download("v1/docs/page.html", target), ErrNotFound)
+}
+
+// writeSite writes the given files to a new temporary directory and returns the directory.
+func writeSite(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "cuckoo-site-*")
+	assert.NilError(t, err)
+
+	for name, contents := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		assert.NilError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NilError(t, ioutil.WriteFile(path, []byte(contents), 0644))
+	}
+	return dir
+}
@@ -0,0 +1,299 @@
+package storage
+
+import (
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.borchero.com/typewriter"
+)
+
+const (
+	releasesDir         = "releases/"
+	releasesHistory     = releasesDir + "history"
+	releasesCurrent     = releasesDir + "current"
+	pointerCacheControl = "no-cache"
+)
+
+var redirectIndexTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="0; url={{ . }}">
+<link rel="canonical" href="{{ . }}">
+</head>
+<body><a href="{{ . }}">{{ . }}</a></body>
+</html>
+`))
+
+// ReleasePointer switches the release of a versioned site which is served to visitors.
+type ReleasePointer func(site *VersionedSite, version string) error
+
+// VersionedSite describes a website whose versions are published as releases to separate
+// directories '<prefix>releases/<version>/'. After a release has been uploaded completely, a
+// pointer is switched to serve the new release. The history of releases and the current release
+// are stored in the objects '<prefix>releases/history' and '<prefix>releases/current'.
+//
+// If a website file is given, its redirects are published with each release and the bucket's
+// website configuration is set to serve the error document of the current release. Otherwise, an
+// existing error document located in a release is moved to the current release when switching.
+type VersionedSite struct {
+	Provider Provider
+	Prefix   string
+	Pointer  ReleasePointer
+	Website  *WebsiteFile
+	Logger   typewriter.CLILogger
+}
+
+// RedirectIndexPointer points to a release by uploading an index file to the site's prefix which
+// redirects visitors to the release's directory.
+func RedirectIndexPointer(site *VersionedSite, version string) error {
+	target := fmt.Sprintf("%s%s/", releasesDir, version)
+	return site.writeObject("index.html", pointerCacheControl, func(file *os.File) error {
+		return redirectIndexTemplate.Execute(file, target)
+	})
+}
+
+// prefix returns the normalized prefix of the site.
+func (site *VersionedSite) prefix() string {
+	return NormalizePrefix(site.Prefix)
+}
+
+// ReleasePath returns the path of the directory of the given release within the bucket.
+func (site *VersionedSite) ReleasePath(version string) string {
+	return fmt.Sprintf("%s%s%s/", site.prefix(), releasesDir, version)
+}
+
+// Releases returns all releases, ordered from oldest to newest, along with the current release.
+func (site *VersionedSite) Releases() ([]string, string, error) {
+	history, err := site.readObject(releasesHistory)
+	if err != nil {
+		return nil, "", err
+	}
+	current, err := site.readObject(releasesCurrent)
+	if err != nil {
+		return nil, "", err
+	}
+	return strings.Fields(history), strings.TrimSpace(current), nil
+}
+
+// Publish publishes a new release with the given version and switches to it. Afterwards, all but
+// the given number of newest releases are removed. Versions of releases which still exist cannot be
+// published again.
+func (site *VersionedSite) Publish(version string, options PublishOptions, keep int) error {
+	// 1) Validate version
+	if version == "" || strings.ContainsAny(version, "/\\ \t\n") {
+		return fmt.Errorf("Invalid release version '%s'", version)
+	}
+	if version == "current" || version == "history" {
+		return fmt.Errorf("Release version '%s' is reserved", version)
+	}
+
+	releases, _, err := site.Releases()
+	if err != nil {
+		return err
+	}
+	// Published releases are immutable, re-publishing one would modify it while being served
+	for _, release := range releases {
+		if release == version {
+			return fmt.Errorf("Release '%s' already exists", version)
+		}
+	}
+
+	// 2) Upload release (purging leftovers of previous attempts which failed before switching)
+	site.Logger.Infof("Publishing release '%s'...", version)
+	options.Prefix = site.ReleasePath(version)
+	options.Purge = true
+	options.Website = site.Website
+	if _, err := Publish(site.Provider, options, site.Logger); err != nil {
+		return err
+	}
+
+	// 3) Record release and switch to it
+	releases = append(releases, version)
+
+	if err := site.writeHistory(releases); err != nil {
+		return err
+	}
+	if err := site.Switch(version); err != nil {
+		return err
+	}
+
+	// 4) Remove old releases
+	if keep < 1 || len(releases) <= keep {
+		return nil
+	}
+	for _, release := range releases[:len(releases)-keep] {
+		if err := site.removeRelease(release); err != nil {
+			return err
+		}
+	}
+	return site.writeHistory(releases[len(releases)-keep:])
+}
+
+// Rollback switches to the given release. If no release is given, it switches to the release
+// published before the current release. It returns the release which is now current.
+func (site *VersionedSite) Rollback(version string) (string, error) {
+	releases, current, err := site.Releases()
+	if err != nil {
+		return "", err
+	}
+
+	// 1) Find release
+	index := -1
+	for i, release := range releases {
+		if (version == "" && release == current) || (version != "" && release == version) {
+			index = i
+		}
+	}
+
+	if version == "" {
+		if index < 1 {
+			return "", fmt.Errorf("There is no release before the current release '%s'", current)
+		}
+		version = releases[index-1]
+	} else if index < 0 {
+		return "", fmt.Errorf("Release '%s' does not exist", version)
+	}
+
+	// 2) Switch
+	if err := site.Switch(version); err != nil {
+		return "", err
+	}
+	return version, nil
+}
+
+// Switch sets the current release and points the site and its error document to it.
+func (site *VersionedSite) Switch(version string) error {
+	site.Logger.Infof("Switching to release '%s'...", version)
+	if site.Pointer != nil {
+		if err := site.Pointer(site, version); err != nil {
+			return fmt.Errorf("Unable to switch to release '%s': %s", version, err)
+		}
+	}
+	if err := site.switchWebsite(version); err != nil {
+		return fmt.Errorf("Unable to switch website to release '%s': %s", version, err)
+	}
+	return site.writeObject(releasesCurrent, pointerCacheControl, func(file *os.File) error {
+		_, err := file.WriteString(version + "\n")
+		return err
+	})
+}
+
+func (site *VersionedSite) switchWebsite(version string) error {
+	if site.Website != nil {
+		config := site.Website.Config(site.ReleasePath(version))
+		return ConfigureWebsite(site.Provider, config, site.Logger)
+	}
+
+	// Move an existing error document to the release
+	provider, ok := site.Provider.(WebsiteProvider)
+	if !ok {
+		return nil
+	}
+	config, err := provider.Website()
+	if err != nil {
+		return err
+	}
+
+	document := site.releaseDocument(config.ErrorDocument, version)
+	if document == config.ErrorDocument {
+		return nil
+	}
+	config.ErrorDocument = document
+	return provider.ConfigureWebsite(config)
+}
+
+// releaseDocument returns the path of the given document within the given release if the document
+// is located in any release. Otherwise, the document is returned as is.
+func (site *VersionedSite) releaseDocument(document, version string) string {
+	releases := site.prefix() + releasesDir
+	if !strings.HasPrefix(document, releases) {
+		return document
+	}
+	parts := strings.SplitN(strings.TrimPrefix(document, releases), "/", 2)
+	if len(parts) != 2 {
+		return document
+	}
+	return site.ReleasePath(version) + parts[1]
+}
+
+func (site *VersionedSite) removeRelease(version string) error {
+	site.Logger.Infof("Removing release '%s'...", version)
+	objects, err := site.Provider.List(site.ReleasePath(version))
+	if err != nil {
+		return err
+	}
+
+	paths := make([]string, len(objects))
+	for i, object := range objects {
+		paths[i] = object.Path
+	}
+	return site.Provider.Delete(paths...)
+}
+
+func (site *VersionedSite) writeHistory(releases []string) error {
+	return site.writeObject(releasesHistory, pointerCacheControl, func(file *os.File) error {
+		_, err := file.WriteString(strings.Join(releases, "\n") + "\n")
+		return err
+	})
+}
+
+// readObject returns the contents of the object at the given path relative to the site's prefix.
+// It returns an empty string if the object does not exist.
+func (site *VersionedSite) readObject(path string) (string, error) {
+	dir, err := ioutil.TempDir("", "cuckoo-release-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+
+	local := filepath.Join(dir, "object")
+	if err := site.Provider.Download(site.prefix()+path, local); err != nil {
+		if err == ErrNotFound {
+			return "", nil
+		}
+		return "", err
+	}
+
+	contents, err := ioutil.ReadFile(local)
+	if err != nil {
+		return "", err
+	}
+	return string(contents), nil
+}
+
+// writeObject uploads an object to the given path relative to the site's prefix whose contents are
+// written by the given function.
+func (site *VersionedSite) writeObject(
+	path, cacheControl string, write func(file *os.File) error,
+) error {
+	dir, err := ioutil.TempDir("", "cuckoo-release-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	// Keep the file name to detect the content type
+	local := filepath.Join(dir, filepath.Base(path))
+	file, err := os.Create(local)
+	if err != nil {
+		return err
+	}
+	if err := write(file); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return site.Provider.Upload(TransferObject{
+		LocalPath:    local,
+		BucketPath:   site.prefix() + path,
+		CacheControl: cacheControl,
+	})
+}
@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"go.borchero.com/typewriter"
+	"gotest.tools/assert"
+)
+
+func TestVersionedSite(t *testing.T) {
+	dir := writeSite(t, map[string]string{"index.html": "<html></html>"})
+	defer os.RemoveAll(dir)
+
+	provider := NewMemory()
+	site := &VersionedSite{
+		Provider: provider,
+		Prefix:   "site/",
+		Pointer:  RedirectIndexPointer,
+		Logger:   typewriter.NewCLILogger(),
+	}
+
+	// 1) Publish releases, keeping two of them
+	options := PublishOptions{Dir: dir}
+	for _, version := range []string{"v1", "v2", "v3"} {
+		assert.NilError(t, site.Publish(version, options, 2))
+	}
+
+	releases, current, err := site.Releases()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, releases, []string{"v2", "v3"})
+	assert.Equal(t, current, "v3")
+
+	_, ok := provider.Object("site/releases/v1/index.html")
+	assert.Assert(t, !ok, "Old release was not removed.")
+	_, ok = provider.Object("site/releases/v3/index.html")
+	assert.Assert(t, ok, "Release was not uploaded.")
+
+	index, ok := provider.Object("site/index.html")
+	assert.Assert(t, ok, "Redirect index was not uploaded.")
+	assert.Assert(t, strings.Contains(string(index.Contents), `url=releases/v3/`))
+	assert.Equal(t, index.Attributes.CacheControl, "no-cache")
+
+	// 2) Roll back to previous release
+	version, err := site.Rollback("")
+	assert.NilError(t, err)
+	assert.Equal(t, version, "v2")
+
+	_, err = site.Rollback("")
+	assert.ErrorContains(t, err, "no release before")
+
+	// 3) Roll forward to a given release
+	version, err = site.Rollback("v3")
+	assert.NilError(t, err)
+	assert.Equal(t, version, "v3")
+
+	_, current, err = site.Releases()
+	assert.NilError(t, err)
+	assert.Equal(t, current, "v3")
+
+	_, err = site.Rollback("v1")
+	assert.ErrorContains(t, err, "does not exist")
+
+	// 4) Existing releases cannot be published again
+	for _, version := range []string{"v2", "v3"} {
+		err = site.Publish(version, options, 2)
+		assert.ErrorContains(t, err, "already exists")
+	}
+}
+
+func TestVersionedSiteInvalidVersion(t *testing.T) {
+	site := &VersionedSite{Provider: NewMemory(), Logger: typewriter.NewCLILogger()}
+	for _, version := range []string{"", "a/b", "v 1", "current"} {
+		err := site.Publish(version, PublishOptions{Dir: "."}, 0)
+		assert.Assert(t, err != nil, version)
+	}
+}
+
+func TestVersionedSiteWebsite(t *testing.T) {
+	dir := writeSite(t, map[string]string{"index.html": "<html></html>"})
+	defer os.RemoveAll(dir)
+
+	provider := NewMemory()
+	site := &VersionedSite{
+		Provider: provider,
+		Prefix:   "site/",
+		Website:  &WebsiteFile{IndexDocument: "index.html", ErrorDocument: "index.html"},
+		Logger:   typewriter.NewCLILogger(),
+	}
+	errorDocument := func() string {
+		config, err := provider.Website()
+		assert.NilError(t, err)
+		return config.ErrorDocument
+	}
+
+	// 1) The error document is located in the current release
+	options := PublishOptions{Dir: dir}
+	for _, version := range []string{"v1", "v2", "v3"} {
+		assert.NilError(t, site.Publish(version, options, 2))
+	}
+	assert.Equal(t, errorDocument(), "site/releases/v3/index.html")
+
+	// 2) Rolling back without website file moves the error document
+	site.Website = nil
+	_, err := site.Rollback("")
+	assert.NilError(t, err)
+	assert.Equal(t, errorDocument(), "site/releases/v2/index.html")
+
+	// 3) Error documents outside of releases are kept
+	assert.NilError(t, provider.ConfigureWebsite(WebsiteConfig{ErrorDocument: "404.html"}))
+	_, err = site.Rollback("v3")
+	assert.NilError(t, err)
+	assert.Equal(t, errorDocument(), "404.html")
+}
+
+func TestVersionedSiteReleasePath(t *testing.T) {
+	for _, prefix := range []string{"docs", "docs/"} {
+		site := &VersionedSite{Prefix: prefix}
+		assert.Equal(t, site.ReleasePath("v1"), "docs/releases/v1/")
+	}
+	site := &VersionedSite{}
+	assert.Equal(t, site.ReleasePath("v1"), "releases/v1/")
+}
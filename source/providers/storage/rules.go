@@ -0,0 +1,169 @@
+package storage
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"gopkg.in/yaml.v2"
+)
+
+// PublishRule describes attributes of all published objects whose paths match a glob pattern.
+// Patterns without a slash are matched against the file name only, '**' matches any number of
+// directories. Empty attributes are not set.
+type PublishRule struct {
+	Match              string            `yaml:"match"`
+	CacheControl       string            `yaml:"cacheControl"`
+	ContentType        string            `yaml:"contentType"`
+	ContentDisposition string            `yaml:"contentDisposition"`
+	Metadata           map[string]string `yaml:"metadata"`
+	Compress           string            `yaml:"compress"`
+	pattern            *regexp.Regexp
+}
+
+// PublishRulesFile describes the rules for publishing files. All rules matching a file are applied
+// in order, i.e. later rules override the attributes set by earlier rules.
+type PublishRulesFile struct {
+	Rules []PublishRule `yaml:"rules"`
+}
+
+// ReadPublishRulesFile reads the rules file at the given path.
+func ReadPublishRulesFile(path string) (*PublishRulesFile, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read rules file: %s", err)
+	}
+
+	var file PublishRulesFile
+	if err := yaml.UnmarshalStrict(contents, &file); err != nil {
+		return nil, fmt.Errorf("Unable to parse rules file: %s", err)
+	}
+
+	for i := range file.Rules {
+		rule := &file.Rules[i]
+		if rule.Match == "" {
+			return nil, fmt.Errorf("Rules file contains a rule without pattern")
+		}
+		if rule.Compress != "" && rule.Compress != "gzip" && rule.Compress != "br" {
+			return nil, fmt.Errorf(
+				"Rule '%s' has unknown compression '%s' (gzip/br)", rule.Match, rule.Compress,
+			)
+		}
+		rule.pattern = globPattern(rule.Match)
+	}
+	return &file, nil
+}
+
+// Apply sets the attributes of all rules matching the given path (relative to the published
+// directory) on the given object. It returns the compression to apply to the object's file, if
+// any.
+func (file *PublishRulesFile) Apply(relPath string, object *TransferObject) string {
+	relPath = filepath.ToSlash(relPath)
+	compress := ""
+	for _, rule := range file.Rules {
+		if !rule.matches(relPath) {
+			continue
+		}
+
+		if rule.CacheControl != "" {
+			object.CacheControl = rule.CacheControl
+		}
+		if rule.ContentType != "" {
+			object.ContentType = rule.ContentType
+		}
+		if rule.ContentDisposition != "" {
+			object.ContentDisposition = rule.ContentDisposition
+		}
+		if len(rule.Metadata) > 0 && object.Metadata == nil {
+			object.Metadata = make(map[string]string)
+		}
+		for key, value := range rule.Metadata {
+			object.Metadata[key] = value
+		}
+		if rule.Compress != "" {
+			compress = rule.Compress
+		}
+	}
+	return compress
+}
+
+func (rule PublishRule) matches(relPath string) bool {
+	if !strings.Contains(rule.Match, "/") {
+		return rule.pattern.MatchString(path.Base(relPath))
+	}
+	return rule.pattern.MatchString(relPath)
+}
+
+// globPattern returns a regular expression matching the same paths as the given glob pattern.
+func globPattern(glob string) *regexp.Regexp {
+	var builder strings.Builder
+	builder.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			builder.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			builder.WriteString(".*")
+			i++
+		case glob[i] == '*':
+			builder.WriteString("[^/]*")
+		case glob[i] == '?':
+			builder.WriteString("[^/]")
+		default:
+			builder.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	builder.WriteString("$")
+	return regexp.MustCompile(builder.String())
+}
+
+// CompressFile compresses the given file with the given compression (gzip/br) and writes the
+// result to the given target path, creating its directory if required. The output only depends on
+// the file's contents such that unchanged files yield unchanged objects.
+func CompressFile(source, target, compression string) error {
+	// 1) Open files
+	input, err := os.Open(source)
+	if err != nil {
+		return fmt.Errorf("Failed opening local file '%s': %s", source, err)
+	}
+	defer input.Close()
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return fmt.Errorf("Failed creating directory for '%s': %s", target, err)
+	}
+	output, err := os.Create(target)
+	if err != nil {
+		return fmt.Errorf("Failed creating local file '%s': %s", target, err)
+	}
+	defer output.Close()
+
+	// 2) Compress
+	var writer io.WriteCloser
+	switch compression {
+	case "gzip":
+		writer, err = gzip.NewWriterLevel(output, gzip.BestCompression)
+		if err != nil {
+			return err
+		}
+	case "br":
+		writer = brotli.NewWriterLevel(output, brotli.BestCompression)
+	default:
+		return fmt.Errorf("Unknown compression '%s'", compression)
+	}
+
+	if _, err := io.Copy(writer, input); err != nil {
+		return fmt.Errorf("Failed compressing local file '%s': %s", source, err)
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("Failed compressing local file '%s': %s", source, err)
+	}
+	return output.Close()
+}
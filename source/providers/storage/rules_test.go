@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestGlobPattern(t *testing.T) {
+	matches := map[string]map[string]bool{
+		"**":             {"index.html": true, "assets/app.js": true},
+		"*.html":         {"index.html": true, "docs/index.html": false},
+		"assets/**/*.js": {"assets/app.js": true, "assets/js/app.js": true, "app.js": false},
+		"img/?.png":      {"img/a.png": true, "img/ab.png": false, "img/a/b.png": false},
+		"downloads/**":   {"downloads/a.zip": true, "downloads.zip": false},
+		"a+b.txt":        {"a+b.txt": true, "aab.txt": false},
+	}
+	for glob, paths := range matches {
+		for path, expected := range paths {
+			actual := globPattern(glob).MatchString(path)
+			assert.Equal(t, actual, expected, "Pattern '%s' fails for '%s'.", glob, path)
+		}
+	}
+}
+
+func TestPublishRules(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cuckoo-rules-*")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "rules.yaml")
+	contents := `
+rules:
+  - match: "**"
+    cacheControl: immutable
+    metadata: {team: web}
+  - match: "*.html"
+    cacheControl: no-cache
+    compress: gzip
+  - match: docs/**
+    contentDisposition: attachment
+    metadata: {section: docs}
+`
+	assert.NilError(t, ioutil.WriteFile(path, []byte(contents), 0644))
+
+	rules, err := ReadPublishRulesFile(path)
+	assert.NilError(t, err)
+
+	object := TransferObject{}
+	assert.Equal(t, rules.Apply("docs/index.html", &object), "gzip")
+	assert.DeepEqual(t, object, TransferObject{
+		CacheControl:       "no-cache",
+		ContentDisposition: "attachment",
+		Metadata:           map[string]string{"team": "web", "section": "docs"},
+	})
+
+	object = TransferObject{}
+	assert.Equal(t, rules.Apply("app.js", &object), "")
+	assert.Equal(t, object.CacheControl, "immutable")
+
+	contents = "rules:\n  - match: '*'\n    compress: zip\n"
+	assert.NilError(t, ioutil.WriteFile(path, []byte(contents), 0644))
+	_, err = ReadPublishRulesFile(path)
+	assert.ErrorContains(t, err, "unknown compression")
+}
+
+func TestCompressFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cuckoo-compress-*")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dir)
+
+	source := filepath.Join(dir, "index.html")
+	assert.NilError(t, ioutil.WriteFile(source, []byte("<html></html>"), 0644))
+
+	// Compressing must be deterministic to detect unchanged files
+	first := filepath.Join(dir, "gzip", "first", "index.html")
+	second := filepath.Join(dir, "gzip", "second", "index.html")
+	assert.NilError(t, CompressFile(source, first, "gzip"))
+	assert.NilError(t, CompressFile(source, second, "gzip"))
+
+	firstInfo, err := LocalObjectInfo(first)
+	assert.NilError(t, err)
+	secondInfo, err := LocalObjectInfo(second)
+	assert.NilError(t, err)
+	assert.Assert(t, firstInfo.Matches(secondInfo), "Compression is not deterministic.")
+
+	file, err := os.Open(first)
+	assert.NilError(t, err)
+	defer file.Close()
+	reader, err := gzip.NewReader(file)
+	assert.NilError(t, err)
+	decompressed, err := ioutil.ReadAll(reader)
+	assert.NilError(t, err)
+	assert.Equal(t, string(decompressed), "<html></html>")
+
+	assert.NilError(t, CompressFile(source, filepath.Join(dir, "index.html.br"), "br"))
+	assert.ErrorContains(t, CompressFile(source, filepath.Join(dir, "x"), "zip"), "Unknown")
+}
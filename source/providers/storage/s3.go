@@ -3,21 +3,38 @@ package storage
 import (
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/session"
 	aws3 "github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	"go.borchero.com/typewriter"
 )
 
+// s3DeleteBatchSize is the maximum number of objects which can be deleted with a single request.
+const s3DeleteBatchSize = 1000
+
 type s3 struct {
-	client *aws3.S3
-	bucket string
-	logger typewriter.CLILogger
+	client   *aws3.S3
+	uploader *s3manager.Uploader
+	engine   *transferEngine
+	bucket   string
+	logger   typewriter.CLILogger
+}
+
+// S3Options describes how to connect to S3. By default, AWS S3 is used.
+type S3Options struct {
+	// Endpoint is the URL of an S3-compatible service (e.g. MinIO, Ceph or R2).
+	Endpoint string
+	// PathStyle indicates whether buckets are addressed via paths instead of subdomains, as
+	// required by most S3-compatible services.
+	PathStyle bool
 }
 
 // NewS3 configures a new AWS S3 instance for usage.
-func NewS3(bucket string, logger typewriter.CLILogger) (Provider, error) {
+func NewS3(bucket string, options S3Options, logger typewriter.CLILogger) (Provider, error) {
 	// 1) Make session
 	if err := os.Setenv("AWS_SDK_LOAD_CONFIG", "1"); err != nil {
 		return nil, fmt.Errorf("Failed setting required environment variable: %s", err)
@@ -29,52 +46,191 @@ func NewS3(bucket string, logger typewriter.CLILogger) (Provider, error) {
 	}
 
 	// 2) Get client
-	client := aws3.New(sess)
+	config := aws.NewConfig().WithS3ForcePathStyle(options.PathStyle)
+	if options.Endpoint != "" {
+		config = config.WithEndpoint(options.Endpoint)
+		// S3-compatible services generally ignore the region but requests must be signed with one
+		if aws.StringValue(sess.Config.Region) == "" {
+			config = config.WithRegion("us-east-1")
+		}
+	}
+
+	client := aws3.New(sess, config)
+	uploader := s3manager.NewUploaderWithClient(client, func(uploader *s3manager.Uploader) {
+		uploader.PartSize = multipartPartSize
+	})
 
 	return &s3{
-		client: client,
-		bucket: bucket,
-		logger: logger,
+		client:   client,
+		uploader: uploader,
+		engine:   newTransferEngine(logger),
+		bucket:   bucket,
+		logger:   logger,
 	}, nil
 }
 
 func (s *s3) Upload(objects ...TransferObject) error {
-	for _, object := range objects {
-		if err := s.uploadObject(object); err != nil {
-			return fmt.Errorf("Failed uploading to S3 bucket '%s': %s", s.bucket, err)
+	description := fmt.Sprintf("Uploads to S3 bucket '%s'", s.bucket)
+	err := s.engine.run(description, len(objects), func(i int) error {
+		return s.uploadObject(objects[i])
+	})
+	if err != nil {
+		return fmt.Errorf("Failed uploading to S3 bucket '%s': %s", s.bucket, err)
+	}
+	return nil
+}
+
+func (s *s3) Download(bucketPath, localPath string) error {
+	s.logger.Infof("Downloading from S3 bucket '%s': %s => %s", s.bucket, bucketPath, localPath)
+
+	// 1) Get object
+	params := &aws3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(bucketPath),
+	}
+	out, err := s.client.GetObject(params)
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == aws3.ErrCodeNoSuchKey {
+			return ErrNotFound
 		}
+		return fmt.Errorf("Failed downloading from S3 bucket '%s': %s", s.bucket, err)
+	}
+	defer out.Body.Close()
+
+	// 2) Write to local file
+	if err := writeLocalFile(localPath, out.Body); err != nil {
+		return fmt.Errorf("Failed downloading from S3 bucket '%s': %s", s.bucket, err)
 	}
 	return nil
 }
 
 func (s *s3) Delete(objects ...string) error {
-	for _, object := range objects {
-		if err := s.deleteObject(object); err != nil {
-			return fmt.Errorf("Failed deleting from S3 bucket '%s': %s", s.bucket, err)
+	batches := make([][]string, 0)
+	for start := 0; start < len(objects); start += s3DeleteBatchSize {
+		end := start + s3DeleteBatchSize
+		if end > len(objects) {
+			end = len(objects)
 		}
+		batches = append(batches, objects[start:end])
+	}
+
+	description := fmt.Sprintf("Batch deletions from S3 bucket '%s'", s.bucket)
+	err := s.engine.run(description, len(batches), func(i int) error {
+		return s.deleteObjects(batches[i])
+	})
+	if err != nil {
+		return fmt.Errorf("Failed deleting from S3 bucket '%s': %s", s.bucket, err)
 	}
 	return nil
 }
 
-func (s *s3) List() ([]string, error) {
+func (s *s3) List(prefix string) ([]ObjectInfo, error) {
 	// 1) Make request
 	params := &aws3.ListObjectsV2Input{
 		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(prefix),
 	}
-	out, err := s.client.ListObjectsV2(params)
-	if err != nil {
+
+	// 2) Get object metadata of all pages
+	result := make([]ObjectInfo, 0)
+	collect := func(page *aws3.ListObjectsV2Output, last bool) bool {
+		for _, object := range page.Contents {
+			result = append(result, s3ObjectInfo(object))
+		}
+		return true
+	}
+	if err := s.client.ListObjectsV2Pages(params, collect); err != nil {
 		return nil, fmt.Errorf("Failed to list objects: %s", err)
 	}
 
-	// 2) Get object names
-	result := make([]string, len(out.Contents))
-	for i, object := range out.Contents {
-		result[i] = *object.Key
+	return result, nil
+}
+
+// Attributes returns the hashes of the attributes of the given objects. They are not included when
+// listing objects and must be requested for each object individually.
+func (s *s3) Attributes(paths ...string) (map[string]string, error) {
+	hashes := make([]string, len(paths))
+	exists := make([]bool, len(paths))
+	description := fmt.Sprintf("Attribute requests to S3 bucket '%s'", s.bucket)
+	err := s.engine.run(description, len(paths), func(i int) error {
+		out, err := s.client.HeadObject(&aws3.HeadObjectInput{
+			Bucket: aws.String(s.bucket),
+			Key:    aws.String(paths[i]),
+		})
+		if err != nil {
+			if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "NotFound" {
+				return nil
+			}
+			return err
+		}
+		hashes[i] = metadataAttributes(aws.StringValueMap(out.Metadata))
+		exists[i] = true
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed getting attributes from S3 bucket '%s': %s", s.bucket, err)
 	}
 
+	result := make(map[string]string)
+	for i, path := range paths {
+		if exists[i] {
+			result[path] = hashes[i]
+		}
+	}
 	return result, nil
 }
 
+func (s *s3) Website() (WebsiteConfig, error) {
+	existing, err := s.getWebsite()
+	if err != nil || existing == nil {
+		return WebsiteConfig{}, err
+	}
+
+	config := WebsiteConfig{}
+	if existing.IndexDocument != nil {
+		config.IndexDocument = aws.StringValue(existing.IndexDocument.Suffix)
+	}
+	if existing.ErrorDocument != nil {
+		config.ErrorDocument = aws.StringValue(existing.ErrorDocument.Key)
+	}
+	return config, nil
+}
+
+func (s *s3) ConfigureWebsite(config WebsiteConfig) error {
+	s.logger.Infof("Configuring website of S3 bucket '%s'", s.bucket)
+
+	// 1) Get existing configuration to keep its routing rules
+	existing, err := s.getWebsite()
+	if err != nil {
+		return err
+	}
+
+	website := &aws3.WebsiteConfiguration{
+		IndexDocument: &aws3.IndexDocument{Suffix: aws.String(config.IndexDocument)},
+	}
+	if config.ErrorDocument != "" {
+		website.ErrorDocument = &aws3.ErrorDocument{Key: aws.String(config.ErrorDocument)}
+	}
+	if existing != nil {
+		if existing.RedirectAllRequestsTo != nil {
+			return fmt.Errorf(
+				"S3 bucket '%s' redirects all requests, its website cannot be configured", s.bucket,
+			)
+		}
+		website.RoutingRules = existing.RoutingRules
+	}
+
+	// 2) Update configuration
+	_, err = s.client.PutBucketWebsite(&aws3.PutBucketWebsiteInput{
+		Bucket:               aws.String(s.bucket),
+		WebsiteConfiguration: website,
+	})
+	if err != nil {
+		return fmt.Errorf("Failed configuring website of S3 bucket '%s': %s", s.bucket, err)
+	}
+	return nil
+}
+
 func (s *s3) uploadObject(object TransferObject) error {
 	s.logger.Infof(
 		"Uploading to S3 bucket '%s': %s => %s",
@@ -90,40 +246,98 @@ func (s *s3) uploadObject(object TransferObject) error {
 
 	// 2) Upload
 	// 2.1) Get Mime
-	mimeType, err := getMimeType(object.LocalPath, file)
+	mimeType, err := objectMimeType(object, file)
 	if err != nil {
 		return fmt.Errorf("Failed getting mime type of local file '%s': %s", object.LocalPath, err)
 	}
 
 	// 2.2) Get parameters
-	params := &aws3.PutObjectInput{
+	params := &s3manager.UploadInput{
 		Bucket:      aws.String(s.bucket),
 		Key:         aws.String(object.BucketPath),
 		Body:        file,
 		ContentType: aws.String(mimeType),
 	}
+	if object.CacheControl != "" {
+		params.CacheControl = aws.String(object.CacheControl)
+	}
+	if object.ContentDisposition != "" {
+		params.ContentDisposition = aws.String(object.ContentDisposition)
+	}
+	if object.ContentEncoding != "" {
+		params.ContentEncoding = aws.String(object.ContentEncoding)
+	}
+	if metadata := uploadMetadata(object); len(metadata) > 0 {
+		params.Metadata = aws.StringMap(metadata)
+	}
+	if object.WebsiteRedirect != "" {
+		params.WebsiteRedirectLocation = aws.String(object.WebsiteRedirect)
+	}
 
-	// 2.3) Upload
-	if _, err := s.client.PutObject(params); err != nil {
+	// 2.3) Upload (in multiple parts if the file is large)
+	if _, err := s.uploader.Upload(params); err != nil {
 		return fmt.Errorf("Failed uploading file to path '%s': %s", object.BucketPath, err)
 	}
 
 	return nil
 }
 
-func (s *s3) deleteObject(object string) error {
-	s.logger.Infof("Deleting from S3 bucket '%s': %s", s.bucket, object)
+func (s *s3) deleteObjects(objects []string) error {
+	s.logger.Infof("Deleting %d objects from S3 bucket '%s'", len(objects), s.bucket)
 
 	// 1) Get parameters
-	params := &aws3.DeleteObjectInput{
+	identifiers := make([]*aws3.ObjectIdentifier, len(objects))
+	for i, object := range objects {
+		identifiers[i] = &aws3.ObjectIdentifier{Key: aws.String(object)}
+	}
+	params := &aws3.DeleteObjectsInput{
 		Bucket: aws.String(s.bucket),
-		Key:    aws.String(object),
+		Delete: &aws3.Delete{Objects: identifiers, Quiet: aws.Bool(true)},
 	}
 
 	// 2) Delete
-	if _, err := s.client.DeleteObject(params); err != nil {
-		return fmt.Errorf("Failed deleting file at path '%s': %s", object, err)
+	out, err := s.client.DeleteObjects(params)
+	if err != nil {
+		return fmt.Errorf("Failed deleting files: %s", err)
+	}
+	if len(out.Errors) > 0 {
+		failure := out.Errors[0]
+		return fmt.Errorf(
+			"Failed deleting %d files, e.g. at path '%s': %s",
+			len(out.Errors), aws.StringValue(failure.Key), aws.StringValue(failure.Message),
+		)
 	}
 
 	return nil
 }
+
+// getWebsite returns the website configuration of the bucket or nil if the bucket is not
+// configured as website.
+func (s *s3) getWebsite() (*aws3.GetBucketWebsiteOutput, error) {
+	out, err := s.client.GetBucketWebsite(&aws3.GetBucketWebsiteInput{
+		Bucket: aws.String(s.bucket),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "NoSuchWebsiteConfiguration" {
+			return nil, nil
+		}
+		return nil, fmt.Errorf(
+			"Failed getting website configuration of S3 bucket '%s': %s", s.bucket, err,
+		)
+	}
+	return out, nil
+}
+
+// s3ObjectInfo returns the metadata of the given object. The ETag equals the MD5 checksum of the
+// object's contents unless the object was uploaded in multiple parts.
+func s3ObjectInfo(object *aws3.Object) ObjectInfo {
+	info := ObjectInfo{
+		Path: aws.StringValue(object.Key),
+		Size: aws.Int64Value(object.Size),
+		ETag: strings.Trim(aws.StringValue(object.ETag), "\""),
+	}
+	if !strings.Contains(info.ETag, "-") {
+		info.MD5 = info.ETag
+	}
+	return info
+}
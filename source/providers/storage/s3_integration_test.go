@@ -0,0 +1,105 @@
+//go:build integration
+// +build integration
+
+package storage
+
+// The integration tests run against an S3-compatible service such as a local MinIO container:
+//
+//	docker run -d -p 9000:9000 minio/minio server /data
+//	AWS_ACCESS_KEY_ID=minioadmin AWS_SECRET_ACCESS_KEY=minioadmin \
+//	S3_TEST_ENDPOINT=http://localhost:9000 go test -tags integration ./providers/storage/...
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	aws3 "github.com/aws/aws-sdk-go/service/s3"
+	"go.borchero.com/typewriter"
+	"gotest.tools/assert"
+)
+
+func TestS3Integration(t *testing.T) {
+	endpoint := os.Getenv("S3_TEST_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("S3_TEST_ENDPOINT is not set")
+	}
+
+	// 1) Create bucket
+	bucket := fmt.Sprintf("cuckoo-test-%d", time.Now().UnixNano())
+	options := S3Options{Endpoint: endpoint, PathStyle: true}
+	provider, err := NewS3(bucket, options, typewriter.NewCLILogger())
+	assert.NilError(t, err)
+
+	client := provider.(*s3).client
+	_, err = client.CreateBucket(&aws3.CreateBucketInput{Bucket: aws.String(bucket)})
+	assert.NilError(t, err)
+
+	dir, err := ioutil.TempDir("", "cuckoo-s3-*")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dir)
+
+	// 2) Upload files
+	objects := make([]TransferObject, 0)
+	for _, name := range []string{"index.html", "assets/app.js", "other/file.txt"} {
+		path := filepath.Join(dir, name)
+		assert.NilError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NilError(t, ioutil.WriteFile(path, []byte(name), 0644))
+		objects = append(objects, TransferObject{LocalPath: path, BucketPath: "site/" + name})
+	}
+	objects[0].CacheControl = "no-cache"
+	assert.NilError(t, provider.Upload(objects...))
+
+	head, err := client.HeadObject(&aws3.HeadObjectInput{
+		Bucket: aws.String(bucket), Key: aws.String("site/index.html"),
+	})
+	assert.NilError(t, err)
+	assert.Equal(t, aws.StringValue(head.ContentType), "text/html; charset=utf-8")
+	assert.Equal(t, aws.StringValue(head.CacheControl), "no-cache")
+
+	attributes, err := provider.(AttributesProvider).Attributes("site/index.html", "missing")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, attributes, map[string]string{
+		"site/index.html": objects[0].AttributesHash(),
+	})
+
+	// 3) List files
+	listed, err := provider.List("site/assets/")
+	assert.NilError(t, err)
+	assert.Equal(t, len(listed), 1)
+	local, err := LocalObjectInfo(objects[1].LocalPath)
+	assert.NilError(t, err)
+	assert.Assert(t, local.Matches(listed[0]), "Listed object does not match local file.")
+
+	// 4) Download file
+	target := filepath.Join(dir, "download")
+	assert.NilError(t, provider.Download("site/index.html", target))
+	contents, err := ioutil.ReadFile(target)
+	assert.NilError(t, err)
+	assert.Equal(t, string(contents), "index.html")
+	assert.Equal(t, provider.Download("missing", target), ErrNotFound)
+
+	// 5) Delete files
+	paths := make([]string, 0)
+	listed, err = provider.List("")
+	assert.NilError(t, err)
+	for _, object := range listed {
+		paths = append(paths, object.Path)
+	}
+	sort.Strings(paths)
+	expected := []string{"site/assets/app.js", "site/index.html", "site/other/file.txt"}
+	assert.DeepEqual(t, paths, expected)
+
+	assert.NilError(t, provider.Delete(paths...))
+	listed, err = provider.List("")
+	assert.NilError(t, err)
+	assert.Equal(t, len(listed), 0)
+
+	_, err = client.DeleteBucket(&aws3.DeleteBucketInput{Bucket: aws.String(bucket)})
+	assert.NilError(t, err)
+}
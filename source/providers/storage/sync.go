@@ -0,0 +1,230 @@
+package storage
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"strings"
+)
+
+// attributesMetadataKey is the metadata key under which the hash of an object's attributes is
+// stored. It only consists of lowercase letters as metadata keys are restricted to identifiers by
+// Azure and header names with underscores are frequently dropped by proxies.
+const attributesMetadataKey = "cuckooattributes"
+
+// SyncPlan describes the changes required to make a bucket match a set of local files.
+type SyncPlan struct {
+	Upload    []TransferObject
+	Delete    []string
+	Unchanged int
+}
+
+// PlanSync compares the given local files with the given objects in the bucket. Local files are
+// only uploaded if their contents or attributes differ from the existing objects (or if force is
+// set). Objects without a local counterpart are deleted if purge is set.
+func PlanSync(local []TransferObject, remote []ObjectInfo, force, purge bool) (SyncPlan, error) {
+	plan := SyncPlan{
+		Upload: make([]TransferObject, 0),
+		Delete: make([]string, 0),
+	}
+
+	existing := make(map[string]ObjectInfo)
+	for _, object := range remote {
+		existing[object.Path] = object
+	}
+
+	// 1) Find changed files
+	paths := make(map[string]bool)
+	for _, object := range local {
+		paths[object.BucketPath] = true
+
+		remoteInfo, ok := existing[object.BucketPath]
+		if !ok || force {
+			plan.Upload = append(plan.Upload, object)
+			continue
+		}
+
+		localInfo, err := LocalObjectInfo(object.LocalPath)
+		if err != nil {
+			return plan, err
+		}
+		if localInfo.Matches(remoteInfo) && object.AttributesHash() == remoteInfo.Attributes {
+			plan.Unchanged++
+		} else {
+			plan.Upload = append(plan.Upload, object)
+		}
+	}
+
+	// 2) Find removed files
+	if purge {
+		for _, object := range remote {
+			if !paths[object.Path] {
+				plan.Delete = append(plan.Delete, object.Path)
+			}
+		}
+	}
+
+	return plan, nil
+}
+
+// AttributesHash returns a hash of the attributes which are set when uploading the object. It is
+// empty if the object does not set any attributes.
+func (object TransferObject) AttributesHash() string {
+	if object.CacheControl == "" && object.ContentType == "" && object.ContentDisposition == "" &&
+		object.ContentEncoding == "" && len(object.Metadata) == 0 && object.WebsiteRedirect == "" {
+		return ""
+	}
+
+	// Encoding cannot fail and sorts map keys such that the hash is deterministic
+	encoded, _ := json.Marshal([]interface{}{
+		object.CacheControl,
+		object.ContentType,
+		object.ContentDisposition,
+		object.ContentEncoding,
+		object.Metadata,
+		object.WebsiteRedirect,
+	})
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:16])
+}
+
+// uploadMetadata returns the metadata to set for the given object, including the hash of its
+// attributes.
+func uploadMetadata(object TransferObject) map[string]string {
+	hash := object.AttributesHash()
+	if hash == "" {
+		return object.Metadata
+	}
+
+	metadata := make(map[string]string, len(object.Metadata)+1)
+	for key, value := range object.Metadata {
+		metadata[key] = value
+	}
+	metadata[attributesMetadataKey] = hash
+	return metadata
+}
+
+// metadataAttributes returns the hash of the attributes stored in the given metadata. Keys are
+// compared case-insensitively as some providers canonicalize them.
+func metadataAttributes(metadata map[string]string) string {
+	for key, value := range metadata {
+		if strings.EqualFold(key, attributesMetadataKey) {
+			return value
+		}
+	}
+	return ""
+}
+
+// LocalObjectInfo returns the size and checksums of the local file at the given path.
+func LocalObjectInfo(path string) (ObjectInfo, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return ObjectInfo{}, fmt.Errorf("Failed opening local file '%s': %s", path, err)
+	}
+	defer file.Close()
+
+	info, err := readObjectInfo(path, file)
+	if err != nil {
+		return ObjectInfo{}, fmt.Errorf("Failed reading local file '%s': %s", path, err)
+	}
+	return info, nil
+}
+
+// readObjectInfo returns the size and checksums of the contents of the given reader.
+func readObjectInfo(path string, reader io.Reader) (ObjectInfo, error) {
+	md5Hash := md5.New()
+	crcHash := crc32.New(crc32.MakeTable(crc32.Castagnoli))
+	partsHash := newMultipartHash(multipartPartSize)
+	size, err := io.Copy(io.MultiWriter(md5Hash, crcHash, partsHash), reader)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+
+	info := ObjectInfo{
+		Path:   path,
+		Size:   size,
+		MD5:    hex.EncodeToString(md5Hash.Sum(nil)),
+		CRC32C: hex.EncodeToString(crcHash.Sum(nil)),
+	}
+	if size > multipartPartSize {
+		info.ETag = partsHash.ETag()
+	}
+	return info, nil
+}
+
+// Matches returns whether the given object has the same contents as this object. Objects without
+// a common checksum never match.
+func (info ObjectInfo) Matches(other ObjectInfo) bool {
+	if info.Size != other.Size {
+		return false
+	}
+	if info.MD5 != "" && other.MD5 != "" {
+		return info.MD5 == other.MD5
+	}
+	if info.CRC32C != "" && other.CRC32C != "" {
+		return info.CRC32C == other.CRC32C
+	}
+	if isMultipartETag(info.ETag) || isMultipartETag(other.ETag) {
+		return info.ETag == other.ETag
+	}
+	return false
+}
+
+// multipartHash computes the ETag which S3 assigns to an object that is uploaded in parts of the
+// given size: the MD5 checksum of the concatenated MD5 checksums of all parts, followed by the
+// number of parts.
+type multipartHash struct {
+	partSize int64
+	written  int64
+	part     hash.Hash
+	sums     []byte
+	parts    int
+}
+
+func newMultipartHash(partSize int64) *multipartHash {
+	return &multipartHash{partSize: partSize, part: md5.New()}
+}
+
+func (h *multipartHash) Write(p []byte) (int, error) {
+	total := len(p)
+	for len(p) > 0 {
+		n := h.partSize - h.written
+		if int64(len(p)) < n {
+			n = int64(len(p))
+		}
+		h.part.Write(p[:n])
+		h.written += n
+		p = p[n:]
+
+		if h.written == h.partSize {
+			h.finishPart()
+		}
+	}
+	return total, nil
+}
+
+// ETag returns the ETag of all data written so far. It must only be called once.
+func (h *multipartHash) ETag() string {
+	if h.written > 0 {
+		h.finishPart()
+	}
+	sum := md5.Sum(h.sums)
+	return fmt.Sprintf("%s-%d", hex.EncodeToString(sum[:]), h.parts)
+}
+
+func (h *multipartHash) finishPart() {
+	h.sums = h.part.Sum(h.sums)
+	h.parts++
+	h.part.Reset()
+	h.written = 0
+}
+
+func isMultipartETag(etag string) bool {
+	return strings.Contains(etag, "-")
+}
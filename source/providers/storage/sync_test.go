@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestPlanSync(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cuckoo-sync-*")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{"same": "a", "changed": "b", "new": "c", "attributes": "a"}
+	for name, contents := range files {
+		err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644)
+		assert.NilError(t, err)
+	}
+
+	same, err := LocalObjectInfo(filepath.Join(dir, "same"))
+	assert.NilError(t, err)
+	assert.Equal(t, same.MD5, "0cc175b9c0f1b6a831c399e269772661", "MD5 is not computed correctly.")
+	assert.Equal(t, same.CRC32C, "c1d04330", "CRC32C is not computed correctly.")
+
+	local := []TransferObject{
+		{LocalPath: filepath.Join(dir, "same"), BucketPath: "same"},
+		{LocalPath: filepath.Join(dir, "changed"), BucketPath: "changed"},
+		{LocalPath: filepath.Join(dir, "new"), BucketPath: "new"},
+		{
+			LocalPath:    filepath.Join(dir, "attributes"),
+			BucketPath:   "attributes",
+			CacheControl: "no-cache",
+		},
+	}
+	remote := []ObjectInfo{
+		{Path: "same", Size: 1, CRC32C: same.CRC32C},
+		{Path: "changed", Size: 1, MD5: same.MD5},
+		{Path: "removed", Size: 1},
+		{Path: "attributes", Size: 1, MD5: same.MD5, Attributes: "outdated"},
+	}
+
+	plan, err := PlanSync(local, remote, false, true)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, plan.Upload, local[1:])
+	assert.DeepEqual(t, plan.Delete, []string{"removed"})
+	assert.Equal(t, plan.Unchanged, 1)
+
+	plan, err = PlanSync(local, remote, true, false)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, plan.Upload, local)
+	assert.DeepEqual(t, plan.Delete, []string{})
+}
+
+func TestAttributesHash(t *testing.T) {
+	assert.Equal(t, TransferObject{LocalPath: "a", BucketPath: "b"}.AttributesHash(), "")
+	assert.Equal(t, TransferObject{Metadata: map[string]string{}}.AttributesHash(), "")
+
+	object := TransferObject{
+		LocalPath:    "a",
+		CacheControl: "no-cache",
+		Metadata:     map[string]string{"a": "1", "b": "2", "c": "3"},
+	}
+	hash := object.AttributesHash()
+	assert.Equal(t, len(hash), 32)
+
+	// Paths and the order of metadata do not matter
+	same := TransferObject{
+		BucketPath:   "b",
+		CacheControl: "no-cache",
+		Metadata:     map[string]string{"c": "3", "b": "2", "a": "1"},
+	}
+	assert.Equal(t, same.AttributesHash(), hash)
+
+	changed := object
+	changed.Metadata = map[string]string{"a": "1", "b": "2"}
+	assert.Assert(t, changed.AttributesHash() != hash)
+	changed = object
+	changed.ContentEncoding = "gzip"
+	assert.Assert(t, changed.AttributesHash() != hash)
+
+	// The hash is stored along with the object's metadata
+	metadata := uploadMetadata(object)
+	assert.Equal(t, len(object.Metadata), 3)
+	assert.Equal(t, metadata[attributesMetadataKey], hash)
+	assert.Equal(t, metadataAttributes(map[string]string{"Cuckooattributes": hash}), hash)
+	assert.Equal(t, metadataAttributes(nil), "")
+}
+
+func TestMultipartHash(t *testing.T) {
+	hash := newMultipartHash(4)
+	hash.Write([]byte("abc"))
+	hash.Write([]byte("defghij"))
+	etag := "446feba4c1b5cc7ad93bf4d44a0e36ac-3"
+	assert.Equal(t, hash.ETag(), etag, "ETag is not computed correctly.")
+
+	local := ObjectInfo{Size: 10, ETag: etag}
+	assert.Assert(t, local.Matches(ObjectInfo{Size: 10, ETag: etag}))
+	other := ObjectInfo{Size: 10, ETag: "0cc175b9c0f1b6a831c399e269772661-3"}
+	assert.Assert(t, !local.Matches(other))
+}
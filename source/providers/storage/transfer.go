@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"go.borchero.com/typewriter"
+)
+
+const (
+	// transferConcurrency is the maximum number of objects transferred concurrently.
+	transferConcurrency = 16
+	// transferAttempts is the maximum number of attempts to transfer a single object.
+	transferAttempts = 3
+	// transferBackoff is the time to wait before retrying a failed transfer. It is doubled after
+	// every attempt.
+	transferBackoff = time.Second
+	// multipartPartSize is the size of the parts in which large files are uploaded.
+	multipartPartSize = 16 * 1024 * 1024
+)
+
+// transferEngine runs transfers of many objects concurrently, retrying failed transfers.
+type transferEngine struct {
+	concurrency int
+	attempts    int
+	backoff     time.Duration
+	logger      typewriter.CLILogger
+}
+
+func newTransferEngine(logger typewriter.CLILogger) *transferEngine {
+	return &transferEngine{
+		concurrency: transferConcurrency,
+		attempts:    transferAttempts,
+		backoff:     transferBackoff,
+		logger:      logger,
+	}
+}
+
+// run calls the given function for the indices of all count items and logs a summary with the
+// given description. It returns an error if any item fails after all attempts.
+func (engine *transferEngine) run(description string, count int, transfer func(i int) error) error {
+	if count == 0 {
+		return nil
+	}
+	start := time.Now()
+
+	// 1) Start workers
+	indices := make(chan int)
+	errs := make([]error, count)
+
+	var wg sync.WaitGroup
+	for w := 0; w < engine.concurrency && w < count; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				errs[i] = engine.retry(func() error { return transfer(i) })
+			}
+		}()
+	}
+
+	// 2) Distribute items
+	for i := 0; i < count; i++ {
+		indices <- i
+	}
+	close(indices)
+	wg.Wait()
+
+	// 3) Summarize
+	failed := 0
+	var firstErr error
+	for _, err := range errs {
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			failed++
+		}
+	}
+
+	duration := time.Since(start).Round(time.Millisecond)
+	engine.logger.Infof("%s: %d of %d succeeded in %s", description, count-failed, count, duration)
+	if failed > 0 {
+		return fmt.Errorf("%d of %d failed, first error: %s", failed, count, firstErr)
+	}
+	return nil
+}
+
+func (engine *transferEngine) retry(transfer func() error) error {
+	backoff := engine.backoff
+	var err error
+	for attempt := 1; attempt <= engine.attempts; attempt++ {
+		if err = transfer(); err == nil {
+			return nil
+		}
+		if attempt < engine.attempts {
+			engine.logger.Infof(
+				"Retrying in %s (attempt %d/%d): %s", backoff, attempt, engine.attempts, err,
+			)
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+	return err
+}
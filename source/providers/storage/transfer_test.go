@@ -0,0 +1,35 @@
+package storage
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"go.borchero.com/typewriter"
+	"gotest.tools/assert"
+)
+
+func TestTransferEngine(t *testing.T) {
+	engine := newTransferEngine(typewriter.NewCLILogger())
+	engine.backoff = 0
+
+	var mutex sync.Mutex
+	attempts := make(map[int]int)
+	transfer := func(i int) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		attempts[i]++
+		if i == 0 || (i%2 == 1 && attempts[i] == 1) {
+			return fmt.Errorf("Transfer %d failed", i)
+		}
+		return nil
+	}
+
+	err := engine.run("Transfers", 50, transfer)
+	assert.ErrorContains(t, err, "1 of 50 failed")
+	assert.Equal(t, attempts[0], transferAttempts, "Failing transfer is not retried.")
+	assert.Equal(t, attempts[1], 2, "Transfer is not retried until it succeeds.")
+	assert.Equal(t, attempts[2], 1, "Successful transfer is retried.")
+
+	assert.NilError(t, engine.run("Transfers", 0, transfer))
+}
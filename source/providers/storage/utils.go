@@ -2,28 +2,29 @@ package storage
 
 import (
 	"fmt"
-	"net/http"
+	"io"
 	"os"
 	"strings"
 )
 
-func getMimeType(filename string, file *os.File) (string, error) {
-	// 1) Check if mime type get be determined from filename
-	if strings.HasSuffix(filename, ".html") {
-		return "text/html", nil
-	} else if strings.HasSuffix(filename, ".css") {
-		return "text/css", nil
-	} else if strings.HasSuffix(filename, ".js") {
-		return "application/javascript", nil
+func writeLocalFile(path string, reader io.Reader) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("Failed creating local file '%s': %s", path, err)
 	}
 
-	// 2) Otherwise, detect content type
-	head := make([]byte, 512)
-	if _, err := file.Read(head); err != nil {
-		return "", fmt.Errorf("Failed to read head of file: %s", err)
+	if _, err := io.Copy(file, reader); err != nil {
+		file.Close()
+		return fmt.Errorf("Failed writing local file '%s': %s", path, err)
 	}
-	if _, err := file.Seek(0, 0); err != nil {
-		return "", fmt.Errorf("Failed to seek to beginning of file: %s", err)
+	return file.Close()
+}
+
+// NormalizePrefix returns the given prefix such that it denotes a directory, i.e. a non-empty
+// prefix always ends with a slash. Otherwise, the prefix 'docs' would also match 'docs-old/'.
+func NormalizePrefix(prefix string) string {
+	if prefix == "" || strings.HasSuffix(prefix, "/") {
+		return prefix
 	}
-	return http.DetectContentType(head), nil
+	return prefix + "/"
 }
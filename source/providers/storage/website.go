@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.borchero.com/typewriter"
+	"gopkg.in/yaml.v2"
+)
+
+// Redirect describes a path of the published directory which redirects visitors to another URL.
+type Redirect struct {
+	From string `yaml:"from"`
+	To   string `yaml:"to"`
+}
+
+// WebsiteFile describes how a bucket serves a published directory as website. Redirects are
+// published as objects along with the directory's files. Index and error document are configured
+// for the bucket. The fallback is an error document served for all paths which do not exist, e.g.
+// for single-page apps.
+type WebsiteFile struct {
+	IndexDocument string     `yaml:"indexDocument"`
+	ErrorDocument string     `yaml:"errorDocument"`
+	Fallback      string     `yaml:"fallback"`
+	Redirects     []Redirect `yaml:"redirects"`
+}
+
+// WebsiteConfig describes the website configuration of a bucket. The error document is the full
+// path of an object while the index document is the name of the objects served for directories.
+type WebsiteConfig struct {
+	IndexDocument string
+	ErrorDocument string
+}
+
+// WebsiteProvider is implemented by providers whose buckets can be configured to serve websites.
+type WebsiteProvider interface {
+
+	// Website returns the website configuration of the bucket. It is empty if the bucket is not
+	// configured as website.
+	Website() (WebsiteConfig, error)
+
+	// ConfigureWebsite sets the website configuration of the bucket and returns an error if the
+	// configuration cannot be updated. Any other website settings of the bucket (e.g. routing
+	// rules) are kept.
+	ConfigureWebsite(config WebsiteConfig) error
+}
+
+// ConfigureWebsite sets the website configuration of the bucket if the provider supports it.
+func ConfigureWebsite(provider Provider, config WebsiteConfig, logger typewriter.CLILogger) error {
+	website, ok := provider.(WebsiteProvider)
+	if !ok {
+		logger.Infof("Storage provider does not support website configuration, skipping...")
+		return nil
+	}
+	return website.ConfigureWebsite(config)
+}
+
+// ReadWebsiteFile reads the website file at the given path.
+func ReadWebsiteFile(path string) (*WebsiteFile, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read website file: %s", err)
+	}
+
+	var file WebsiteFile
+	if err := yaml.UnmarshalStrict(contents, &file); err != nil {
+		return nil, fmt.Errorf("Unable to parse website file: %s", err)
+	}
+
+	if file.IndexDocument == "" {
+		file.IndexDocument = "index.html"
+	}
+	if file.Fallback != "" {
+		if file.ErrorDocument != "" {
+			return nil, fmt.Errorf("Website file must not set both error document and fallback")
+		}
+		file.ErrorDocument = file.Fallback
+	}
+
+	for _, redirect := range file.Redirects {
+		if strings.TrimPrefix(redirect.From, "/") == "" {
+			return nil, fmt.Errorf("Website file contains a redirect without source path")
+		}
+		if !strings.HasPrefix(redirect.To, "/") && !strings.HasPrefix(redirect.To, "http://") &&
+			!strings.HasPrefix(redirect.To, "https://") {
+			return nil, fmt.Errorf(
+				"Redirect target '%s' must be an absolute path or an HTTP(S) URL", redirect.To,
+			)
+		}
+	}
+	return &file, nil
+}
+
+// Config returns the website configuration of a bucket serving the directory at the given prefix.
+func (file *WebsiteFile) Config(prefix string) WebsiteConfig {
+	config := WebsiteConfig{IndexDocument: file.IndexDocument}
+	if file.ErrorDocument != "" {
+		config.ErrorDocument = prefix + strings.TrimPrefix(file.ErrorDocument, "/")
+	}
+	return config
+}
+
+// redirectObjects writes a page for each redirect to the given directory and returns the objects
+// to upload. Redirects from directories ending with a slash are served by their index document.
+// The pages redirect visitors on their own, S3 additionally redirects via the object's metadata.
+func (file *WebsiteFile) redirectObjects(dir, prefix string) ([]TransferObject, error) {
+	objects := make([]TransferObject, len(file.Redirects))
+	for i, redirect := range file.Redirects {
+		relPath := strings.TrimPrefix(redirect.From, "/")
+		if strings.HasSuffix(relPath, "/") {
+			relPath += file.IndexDocument
+		}
+
+		// 1) Write page
+		local := filepath.Join(dir, fmt.Sprintf("redirect-%d.html", i))
+		page, err := os.Create(local)
+		if err != nil {
+			return nil, fmt.Errorf("Failed creating local file '%s': %s", local, err)
+		}
+		if err := redirectIndexTemplate.Execute(page, redirect.To); err != nil {
+			page.Close()
+			return nil, fmt.Errorf("Failed writing redirect from '%s': %s", redirect.From, err)
+		}
+		if err := page.Close(); err != nil {
+			return nil, err
+		}
+
+		// 2) Get object
+		objects[i] = TransferObject{
+			LocalPath:       local,
+			BucketPath:      prefix + relPath,
+			ContentType:     "text/html; charset=utf-8",
+			CacheControl:    "no-cache",
+			WebsiteRedirect: redirect.To,
+		}
+	}
+	return objects, nil
+}
@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.borchero.com/typewriter"
+	"gotest.tools/assert"
+)
+
+func TestReadWebsiteFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cuckoo-website-*")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "website.yaml")
+	read := func(contents string) (*WebsiteFile, error) {
+		assert.NilError(t, ioutil.WriteFile(path, []byte(contents), 0644))
+		return ReadWebsiteFile(path)
+	}
+
+	// Fallback sets the error document
+	file, err := read("fallback: index.html\n")
+	assert.NilError(t, err)
+	config := file.Config("site/")
+	assert.Equal(t, config.IndexDocument, "index.html")
+	assert.Equal(t, config.ErrorDocument, "site/index.html")
+
+	_, err = read("errorDocument: 404.html\nfallback: index.html\n")
+	assert.ErrorContains(t, err, "both")
+
+	_, err = read("redirects:\n  - from: /old.html\n    to: new.html\n")
+	assert.ErrorContains(t, err, "absolute path")
+
+	_, err = read("redirects:\n  - from: /\n    to: /new.html\n")
+	assert.ErrorContains(t, err, "without source path")
+
+	_, err = read("unknown: true\n")
+	assert.ErrorContains(t, err, "Unable to parse")
+}
+
+func TestPublishWebsite(t *testing.T) {
+	dir := writeSite(t, map[string]string{"index.html": "<html></html>"})
+	defer os.RemoveAll(dir)
+
+	provider := NewMemory()
+	website := &WebsiteFile{
+		IndexDocument: "index.html",
+		ErrorDocument: "index.html",
+		Redirects: []Redirect{
+			{From: "/old/page.html", To: "/new/page.html"},
+			{From: "/blog/", To: "https://blog.example.com/"},
+		},
+	}
+	options := PublishOptions{Dir: dir, Prefix: "site/", Website: website, Purge: true}
+
+	// 1) Publish redirects and configure website
+	plan, err := Publish(provider, options, typewriter.NewCLILogger())
+	assert.NilError(t, err)
+	assert.Equal(t, len(plan.Upload), 3)
+
+	object, ok := provider.Object("site/old/page.html")
+	assert.Assert(t, ok, "Redirect was not uploaded.")
+	assert.Equal(t, object.Attributes.WebsiteRedirect, "/new/page.html")
+	assert.Assert(t, strings.Contains(string(object.Contents), "url=/new/page.html"))
+
+	object, ok = provider.Object("site/blog/index.html")
+	assert.Assert(t, ok, "Redirect from directory was not uploaded.")
+	assert.Equal(t, object.Attributes.WebsiteRedirect, "https://blog.example.com/")
+
+	// Publishing does not change the website configuration
+	config, err := provider.Website()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, config, WebsiteConfig{})
+
+	logger := typewriter.NewCLILogger()
+	assert.NilError(t, ConfigureWebsite(provider, website.Config("site/"), logger))
+	config, err = provider.Website()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, config, WebsiteConfig{
+		IndexDocument: "index.html", ErrorDocument: "site/index.html",
+	})
+
+	// 2) Redirects are unchanged and not purged
+	plan, err = Publish(provider, options, typewriter.NewCLILogger())
+	assert.NilError(t, err)
+	assert.Equal(t, plan.Unchanged, 3)
+	assert.Equal(t, len(plan.Delete), 0)
+
+	// 3) Redirects must not replace files
+	website.Redirects = []Redirect{{From: "/index.html", To: "/other.html"}}
+	_, err = Publish(provider, options, typewriter.NewCLILogger())
+	assert.ErrorContains(t, err, "conflicts")
+}
@@ -0,0 +1,123 @@
+package traffic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/cli"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	nginxCanaryAnnotation       = "nginx.ingress.kubernetes.io/canary"
+	nginxCanaryWeightAnnotation = "nginx.ingress.kubernetes.io/canary-weight"
+)
+
+type annotation struct {
+	client      kubernetes.Interface
+	namespace   string
+	kind        string
+	name        string
+	annotations func(weight int) map[string]string
+	values      []string
+}
+
+// NewNginx creates a new traffic provider which sets the canary annotations of the NGINX ingress
+// controller on the canary's ingress with the given name. The canary is installed with the
+// annotations (and a weight of 0) set in the values at the given key (e.g. 'ingress.annotations')
+// as the NGINX ingress controller would otherwise route traffic to the canary's ingress.
+func NewNginx(namespace, ingress, valuesKey string) (Provider, error) {
+	return newAnnotation(namespace, "Ingress", ingress, func(weight int) map[string]string {
+		return map[string]string{
+			nginxCanaryAnnotation:       "true",
+			nginxCanaryWeightAnnotation: strconv.Itoa(weight),
+		}
+	}, nginxCanaryValues(valuesKey))
+}
+
+// NewAnnotation creates a new traffic provider which writes the canary weight into the given
+// annotation of a service or an ingress (kind must be one of Service/Ingress). This enables using
+// any ingress controller or service mesh which reads traffic weights from annotations.
+func NewAnnotation(namespace, kind, name, key string) (Provider, error) {
+	if kind != "Service" && kind != "Ingress" {
+		return nil, fmt.Errorf("Kind '%s' is not supported for traffic shifting", kind)
+	}
+
+	return newAnnotation(namespace, kind, name, func(weight int) map[string]string {
+		return map[string]string{key: strconv.Itoa(weight)}
+	}, nil)
+}
+
+func newAnnotation(
+	namespace, kind, name string, annotations func(int) map[string]string, values []string,
+) (Provider, error) {
+	// 1) Get client
+	config, err := cli.New().RESTClientGetter().ToRESTConfig()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read kubeconfig: %s", err)
+	}
+
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to initialize Kubernetes client: %s", err)
+	}
+
+	return &annotation{
+		client:      client,
+		namespace:   namespace,
+		kind:        kind,
+		name:        name,
+		annotations: annotations,
+		values:      values,
+	}, nil
+}
+
+// nginxCanaryValues returns the values setting the canary annotations with a weight of 0 in the
+// annotations at the given key. Dots in the annotations' names are escaped for Helm.
+func nginxCanaryValues(key string) []string {
+	escape := strings.NewReplacer(".", `\.`)
+	return []string{
+		fmt.Sprintf("%s.%s=true", key, escape.Replace(nginxCanaryAnnotation)),
+		fmt.Sprintf("%s.%s=0", key, escape.Replace(nginxCanaryWeightAnnotation)),
+	}
+}
+
+func (a *annotation) CanaryValues() []string {
+	return a.values
+}
+
+func (a *annotation) SetCanaryWeight(weight int) error {
+	// 1) Build patch
+	patch := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": a.annotations(weight),
+		},
+	}
+	data, err := json.Marshal(patch)
+	if err != nil {
+		return fmt.Errorf("Unable to encode annotations: %s", err)
+	}
+
+	// 2) Apply patch
+	ctx := context.Background()
+	options := metav1.PatchOptions{}
+	switch a.kind {
+	case "Service":
+		_, err = a.client.CoreV1().Services(a.namespace).Patch(
+			ctx, a.name, types.MergePatchType, data, options,
+		)
+	default:
+		_, err = a.client.NetworkingV1().Ingresses(a.namespace).Patch(
+			ctx, a.name, types.MergePatchType, data, options,
+		)
+	}
+	if err != nil {
+		return fmt.Errorf("Unable to set traffic weight on %s '%s': %s", a.kind, a.name, err)
+	}
+	return nil
+}
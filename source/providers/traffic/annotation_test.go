@@ -0,0 +1,15 @@
+package traffic
+
+import (
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestNginxCanaryValues(t *testing.T) {
+	values := nginxCanaryValues("ingress.annotations")
+	assert.DeepEqual(t, values, []string{
+		`ingress.annotations.nginx\.ingress\.kubernetes\.io/canary=true`,
+		`ingress.annotations.nginx\.ingress\.kubernetes\.io/canary-weight=0`,
+	})
+}
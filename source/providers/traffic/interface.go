@@ -0,0 +1,14 @@
+package traffic
+
+// Provider is an interface that enables shifting traffic between the stable and the canary version
+// of an application.
+type Provider interface {
+
+	// SetCanaryWeight routes the given percentage (0-100) of traffic to the canary version and
+	// returns an error upon failure.
+	SetCanaryWeight(weight int) error
+
+	// CanaryValues returns the Helm values (given as string values) with which the canary has to
+	// be installed such that it does not receive any traffic before its weight is set.
+	CanaryValues() []string
+}
@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"io"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -8,18 +9,34 @@ import (
 
 type directoryWalker struct {
 	files   []string
-	pattern string
+	pattern *regexp.Regexp
+	skip    map[string]bool
 }
 
 // GetMatchingFiles recursively steps through all files in the current working directory and finds
 // files matching the specified regex pattern.
 func GetMatchingFiles(pattern string, source string) ([]string, error) {
+	return GetMatchingFilesSkipping(pattern, source, nil)
+}
+
+// GetMatchingFilesSkipping works like GetMatchingFiles but does not descend into directories
+// whose names are contained in the given list (e.g. '.git').
+func GetMatchingFilesSkipping(pattern string, source string, skip []string) ([]string, error) {
+	regex, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+
 	walker := &directoryWalker{
 		files:   make([]string, 0),
-		pattern: pattern,
+		pattern: regex,
+		skip:    make(map[string]bool),
 	}
-	err := filepath.Walk(source, walker.dirWalk)
-	if err != nil {
+	for _, name := range skip {
+		walker.skip[name] = true
+	}
+
+	if err := filepath.Walk(source, walker.dirWalk); err != nil {
 		return nil, err
 	}
 	return walker.files, nil
@@ -30,12 +47,60 @@ func (walker *directoryWalker) dirWalk(path string, info os.FileInfo, err error)
 		return err
 	}
 	if info.IsDir() {
+		if walker.skip[info.Name()] {
+			return filepath.SkipDir
+		}
 		return nil
 	}
 
-	regex := regexp.MustCompile(walker.pattern)
-	if regex.MatchString(path) {
+	if walker.pattern.MatchString(path) {
 		walker.files = append(walker.files, path)
 	}
 	return nil
 }
+
+// CopyDir recursively copies all files and directories from the source directory to the target
+// directory. The target directory is created if it does not exist.
+func CopyDir(source string, target string) error {
+	return filepath.Walk(source, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(source, path)
+		if err != nil {
+			return err
+		}
+		targetPath := filepath.Join(target, relPath)
+
+		if info.IsDir() {
+			return os.MkdirAll(targetPath, info.Mode().Perm())
+		}
+		return CopyFile(path, targetPath)
+	})
+}
+
+// CopyFile copies the file at the source path to the target path, preserving its permissions.
+func CopyFile(source string, target string) error {
+	input, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+
+	info, err := input.Stat()
+	if err != nil {
+		return err
+	}
+
+	output, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(output, input); err != nil {
+		output.Close()
+		return err
+	}
+	return output.Close()
+}
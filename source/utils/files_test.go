@@ -0,0 +1,77 @@
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestGetMatchingFilesSkipping(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cuckoo-files-*")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{
+		"app.enc.yaml",
+		"config/db.enc.env",
+		"config/plain.yaml",
+		".git/objects/x.enc.yaml",
+		"node_modules/pkg/y.enc.json",
+		"vendor/node_modules/z.enc.json",
+	} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		assert.NilError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NilError(t, ioutil.WriteFile(path, []byte{}, 0644))
+	}
+
+	relative := func(files []string) []string {
+		result := make([]string, len(files))
+		for i, file := range files {
+			rel, err := filepath.Rel(dir, file)
+			assert.NilError(t, err)
+			result[i] = filepath.ToSlash(rel)
+		}
+		sort.Strings(result)
+		return result
+	}
+
+	testCases := []struct {
+		name     string
+		skip     []string
+		expected []string
+	}{
+		{
+			name: "NoSkip",
+			skip: nil,
+			expected: []string{
+				".git/objects/x.enc.yaml", "app.enc.yaml", "config/db.enc.env",
+				"node_modules/pkg/y.enc.json", "vendor/node_modules/z.enc.json",
+			},
+		},
+		{
+			name:     "SkipNestedDirectories",
+			skip:     []string{".git", "node_modules"},
+			expected: []string{"app.enc.yaml", "config/db.enc.env"},
+		},
+		{
+			name:     "SkipDirectoryWithMatches",
+			skip:     []string{".git", "node_modules", "config"},
+			expected: []string{"app.enc.yaml"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			files, err := GetMatchingFilesSkipping(`\.enc\.`, dir, testCase.skip)
+			assert.NilError(t, err)
+			assert.DeepEqual(t, relative(files), testCase.expected)
+		})
+	}
+
+	_, err = GetMatchingFilesSkipping("(", dir, nil)
+	assert.Assert(t, err != nil, "Invalid pattern must fail.")
+}
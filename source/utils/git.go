@@ -0,0 +1,33 @@
+package utils
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// IsGitWorkTree returns whether the given directory is located within a git work tree. It returns
+// false if git is not installed.
+func IsGitWorkTree(dir string) bool {
+	cmd := exec.Command("git", "rev-parse", "--is-inside-work-tree")
+	cmd.Dir = dir
+	output, err := cmd.Output()
+	return err == nil && strings.TrimSpace(string(output)) == "true"
+}
+
+// IsGitIgnored returns whether the given path is ignored by git, i.e. it is not tracked and
+// matches a pattern of any .gitignore file. It fails if the path is not within a git repository.
+func IsGitIgnored(path string) (bool, error) {
+	cmd := exec.Command("git", "check-ignore", "--quiet", filepath.Base(path))
+	cmd.Dir = filepath.Dir(path)
+	err := cmd.Run()
+	if err == nil {
+		return true, nil
+	}
+
+	if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
+		return false, nil
+	}
+	return false, fmt.Errorf("Unable to check whether '%s' is ignored by git: %s", path, err)
+}
@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestGitIgnored(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir, err := ioutil.TempDir("", "cuckoo-git-*")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dir)
+
+	// Directories outside of repositories are no work trees
+	assert.Assert(t, !IsGitWorkTree(dir), "Directory must not be a git work tree.")
+	assert.Assert(t, !IsGitWorkTree(filepath.Join(dir, "missing")), "Missing directory.")
+
+	// Files in repositories are checked against .gitignore
+	assert.NilError(t, exec.Command("git", "init", "--quiet", dir).Run())
+	assert.Assert(t, IsGitWorkTree(dir), "Repository must be a git work tree.")
+
+	ignore := filepath.Join(dir, ".gitignore")
+	assert.NilError(t, ioutil.WriteFile(ignore, []byte("*.dec.yaml\n"), 0644))
+
+	ignored, err := IsGitIgnored(filepath.Join(dir, "secrets.dec.yaml"))
+	assert.NilError(t, err)
+	assert.Assert(t, ignored, "File matching .gitignore is not ignored.")
+
+	ignored, err = IsGitIgnored(filepath.Join(dir, "secrets.yaml"))
+	assert.NilError(t, err)
+	assert.Assert(t, !ignored, "File not matching .gitignore is ignored.")
+}
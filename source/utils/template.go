@@ -22,7 +22,27 @@ func PopulateTemplateWrite(templateFile string, outputFile string, values interf
 // PopulateTemplate replaces values in a template file with Go's native template engine and
 // returns the contents.
 func PopulateTemplate(templateFile string, values interface{}) ([]byte, error) {
-	file, err := pkger.Open("/utils/templates/" + templateFile)
+	source, err := ioutil.ReadFile(templateFile)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading file: %s", err)
+	}
+	return populateTemplateSource(templateFile, source, values)
+}
+
+// PopulateBundledTemplateWrite replaces values in a template bundled with the binary and writes the
+// result to an output file.
+func PopulateBundledTemplateWrite(templateName, outputFile string, values interface{}) error {
+	b, err := PopulateBundledTemplate(templateName, values)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(outputFile, b, 0644)
+}
+
+// PopulateBundledTemplate replaces values in a template bundled with the binary and returns the
+// contents.
+func PopulateBundledTemplate(templateName string, values interface{}) ([]byte, error) {
+	file, err := pkger.Open("/utils/templates/" + templateName)
 	if err != nil {
 		return nil, fmt.Errorf("Error opening file: %s", err)
 	}
@@ -32,8 +52,11 @@ func PopulateTemplate(templateFile string, values interface{}) ([]byte, error) {
 	if err != nil {
 		return nil, fmt.Errorf("Error reading file: %s", err)
 	}
+	return populateTemplateSource(templateName, source, values)
+}
 
-	tmpl, err := template.New(templateFile).Parse(string(source))
+func populateTemplateSource(name string, source []byte, values interface{}) ([]byte, error) {
+	tmpl, err := template.New(name).Parse(string(source))
 	if err != nil {
 		return nil, fmt.Errorf("Error compiling template: %s", err)
 	}